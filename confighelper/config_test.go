@@ -10,6 +10,7 @@ type Config struct {
 	Debug   bool              `yaml:"debug"`
 	Server  *ConnectionOption `yaml:"server"`
 	Couchdb *ConnectionOption `yaml:"couchdb"`
+	Partner *ConnectionOption `yaml:"partner"`
 }
 
 func TestLoadConfig(t *testing.T) {
@@ -28,4 +29,8 @@ func TestLoadConfig(t *testing.T) {
 	t.Log(cfg.Server.Host)
 	t.Log(cfg.Server.Port)
 	t.Log(cfg.Server.User)
+
+	if cfg.Partner.TLS == nil || len(cfg.Partner.TLS.CAFiles) != 1 || cfg.Partner.TLS.MinVersion != "1.2" {
+		t.Errorf("unexpected partner tls config: %+v", cfg.Partner.TLS)
+	}
 }
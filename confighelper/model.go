@@ -9,6 +9,31 @@ type ConnectionOption struct {
 	User     string `json:"user" yaml:"user"`
 	Passwd   string `json:"passwd" yaml:"passwd"`
 	Protocol string `json:"protocol" yaml:"protocol"`
+
+	// optional, for https connections
+	TLS *TLSOption `json:"tls" yaml:"tls"`
+}
+
+// tls config model, file paths are PEM files, see test/example_config.yaml
+type TLSOption struct {
+	// private root CAs, system roots are used if empty
+	CAFiles []string `json:"caFiles" yaml:"caFiles"`
+
+	// client cert/key pair for mTLS
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+
+	// "1.0", "1.1", "1.2" or "1.3", default is "1.2"
+	MinVersion string `json:"minVersion" yaml:"minVersion"`
+
+	// override server name used to verify server certificate
+	ServerName string `json:"serverName" yaml:"serverName"`
+
+	// base64 encoded sha256 of server certificate SubjectPublicKeyInfo,
+	// any certificate in the chain matching one of them passes
+	PinnedSPKI []string `json:"pinnedSPKI" yaml:"pinnedSPKI"`
+
+	InsecureSkipVerify bool `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
 }
 
 func (c *ConnectionOption) ListenServerAddr() string {
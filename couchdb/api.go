@@ -9,6 +9,7 @@ import (
 	"github.com/leyle/go-api-starter/httpclient"
 	"github.com/rs/zerolog"
 	"net/http"
+	"time"
 )
 
 // Create / UpdateById / GetById / DeleteById / Search
@@ -23,6 +24,13 @@ type CouchDBOption struct {
 
 	// http or https
 	Protocol string
+
+	// clustered couchdb nodes, if set, HostPort is ignored and requests are balanced
+	// over nodes with less outstanding requests, failing nodes are ejected for a while
+	HostPorts []string
+
+	// if > 0 and HostPorts is set, a read not answered after HedgeDelay is sent to another node too
+	HedgeDelay time.Duration
 }
 
 type CouchDBClient struct {
@@ -30,16 +38,57 @@ type CouchDBClient struct {
 	db  string
 	// method name, used by logger
 	method string
+
+	client *httpclient.Client
 }
 
+// New panics if a HostPorts item is invalid, use NewClient to get the error
 func New(opt *CouchDBOption, db string) *CouchDBClient {
+	c, err := NewClient(opt, db)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewClient returns error if a HostPorts item is not a valid node address
+func NewClient(opt *CouchDBOption, db string) (*CouchDBClient, error) {
 	if opt.Protocol == "" {
 		opt.Protocol = "http"
 	}
+	client, err := newHttpClient(opt)
+	if err != nil {
+		return nil, err
+	}
 	return &CouchDBClient{
-		Opt: opt,
-		db:  db,
+		Opt:    opt,
+		db:     db,
+		client: client,
+	}, nil
+}
+
+func newHttpClient(opt *CouchDBOption) (*httpclient.Client, error) {
+	if len(opt.HostPorts) == 0 {
+		return httpclient.DefaultClient, nil
+	}
+
+	targets := make([]string, 0, len(opt.HostPorts))
+	for _, hp := range opt.HostPorts {
+		targets = append(targets, fmt.Sprintf("%s://%s", opt.Protocol, hp))
+	}
+	lb, err := httpclient.NewBalancer(&httpclient.BalancerOption{
+		Targets:    targets,
+		Policy:     httpclient.LeastOutstanding,
+		HedgeDelay: opt.HedgeDelay,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid couchdb hostPorts, %w", err)
 	}
+
+	return httpclient.NewClient(&httpclient.ClientOption{
+		Name:        "couchdb",
+		Middlewares: []httpclient.Middleware{httpclient.LogMiddleware, lb.Middleware},
+	}), nil
 }
 
 func (c *CouchDBOption) basicAuth() map[string]string {
@@ -54,19 +103,17 @@ func (c *CouchDBOption) basicAuth() map[string]string {
 	return headers
 }
 
-func isHttpStatusCodeOK(code int) bool {
-	if code == http.StatusOK || code == http.StatusCreated {
-		return true
-	}
-	return false
-}
-
 func (c *CouchDBClient) basicAuth() map[string]string {
 	return c.Opt.basicAuth()
 }
 
 func (c *CouchDBClient) dbURL() string {
-	return fmt.Sprintf("%s://%s/%s", c.Opt.Protocol, c.Opt.HostPort, c.db)
+	host := c.Opt.HostPort
+	if len(c.Opt.HostPorts) > 0 {
+		// replaced by the selected node
+		host = "couchdb"
+	}
+	return fmt.Sprintf("%s://%s/%s", c.Opt.Protocol, host, c.db)
 }
 
 func (c *CouchDBClient) docIdURL(docId string) string {
@@ -87,39 +134,33 @@ func (c *CouchDBClient) CreateDatabase(ctx context.Context) error {
 	url := c.dbURL()
 
 	req := &httpclient.ClientRequest{
-		Ctx:     ctx,
-		Url:     url,
-		Headers: headers,
-		Debug:   true,
+		Ctx:          ctx,
+		Url:          url,
+		Headers:      headers,
+		FailOnNon2xx: true,
+		Debug:        true,
 	}
 
-	resp := httpclient.Get(req)
-	if resp.Err != nil {
-		resp.Logger.Error().Err(resp.Err).Str("action", c.method).Send()
-		return resp.Err
-	}
-
-	if isHttpStatusCodeOK(resp.Code) {
+	resp := c.client.Get(req)
+	if resp.Err == nil {
 		resp.Logger.Debug().Str("action", c.method).Str("database", c.db).Msg("database already exist")
 		return nil
 	}
 
-	if resp.Code == http.StatusNotFound {
-		// db not exist, create it
-		err := c.CreateDoc(ctx, "", nil)
-		if err != nil {
-			resp.Logger.Error().Err(err).Str("action", c.method).Str("database", c.db).Msg("create database failed")
-			return err
-		}
+	if !httpclient.IsStatusCode(resp.Err, http.StatusNotFound) {
+		resp.Logger.Error().Err(resp.Err).Str("action", c.method).Str("database", c.db).Msg("create database failed")
+		return resp.Err
+	}
 
-		resp.Logger.Debug().Str("action", c.method).Str("database", c.db).Msg("create database success")
-		return nil
-	} else {
-		// other errors
-		err := fmt.Errorf("statusCode[%d], body:%s", resp.Code, string(resp.Body))
+	// db not exist, create it
+	err := c.CreateDoc(ctx, "", nil)
+	if err != nil {
 		resp.Logger.Error().Err(err).Str("action", c.method).Str("database", c.db).Msg("create database failed")
 		return err
 	}
+
+	resp.Logger.Debug().Str("action", c.method).Str("database", c.db).Msg("create database success")
+	return nil
 }
 
 func (c *CouchDBClient) CreateIndex(ctx context.Context, fields []string) error {
@@ -148,27 +189,22 @@ func (c *CouchDBClient) createIndex(ctx context.Context, field string) error {
 	data, _ := json.Marshal(body)
 
 	req := &httpclient.ClientRequest{
-		Ctx:     ctx,
-		Url:     url,
-		Headers: headers,
-		Body:    data,
-		Debug:   true,
+		Ctx:          ctx,
+		Url:          url,
+		Headers:      headers,
+		Body:         data,
+		FailOnNon2xx: true,
+		Debug:        true,
 	}
 
-	resp := httpclient.Post(req)
+	resp := c.client.Post(req)
 	if resp.Err != nil {
 		resp.Logger.Error().Err(resp.Err).Str("action", c.method).Str("database", c.db).Send()
 		return resp.Err
 	}
 
-	if isHttpStatusCodeOK(resp.Code) {
-		resp.Logger.Info().Str("action", c.method).Str("database", c.db).Send()
-		return nil
-	}
-
-	err := fmt.Errorf("statusCode[%d], body[%s]", resp.Code, string(resp.Body))
-	resp.Logger.Error().Err(err).Str("action", c.method).Str("database", c.db).Send()
-	return err
+	resp.Logger.Info().Str("action", c.method).Str("database", c.db).Send()
+	return nil
 }
 
 // create DBName or item
@@ -181,26 +217,21 @@ func (c *CouchDBClient) CreateDoc(ctx context.Context, id string, data []byte) e
 	authHeader := c.basicAuth()
 
 	cReq := &httpclient.ClientRequest{
-		Ctx:     ctx,
-		Url:     url,
-		Headers: authHeader,
-		Body:    data,
-		Debug:   true,
+		Ctx:          ctx,
+		Url:          url,
+		Headers:      authHeader,
+		Body:         data,
+		FailOnNon2xx: true,
+		Debug:        true,
 	}
 
-	resp := httpclient.Put(cReq)
+	resp := c.client.Put(cReq)
 	if resp.Err != nil {
 		resp.Logger.Err(resp.Err).Str("action", c.method).Str("id", id).Msg("Create data failed")
 		return resp.Err
 	}
 
-	if isHttpStatusCodeOK(resp.Code) {
-		return nil
-	}
-
-	err := fmt.Errorf("statusCode[%d], body[%s]", resp.Code, string(resp.Body))
-	resp.Logger.Error().Err(err).Str("action", c.method).Str("id", id).Send()
-	return err
+	return nil
 }
 
 func (c *CouchDBClient) UpdateById(ctx context.Context, id string, data []byte) ([]byte, error) {
@@ -209,26 +240,21 @@ func (c *CouchDBClient) UpdateById(ctx context.Context, id string, data []byte)
 	authHeader := c.basicAuth()
 
 	cReq := &httpclient.ClientRequest{
-		Ctx:     ctx,
-		Url:     url,
-		Headers: authHeader,
-		Body:    data,
-		Debug:   true,
+		Ctx:          ctx,
+		Url:          url,
+		Headers:      authHeader,
+		Body:         data,
+		FailOnNon2xx: true,
+		Debug:        true,
 	}
 
-	resp := httpclient.Put(cReq)
+	resp := c.client.Put(cReq)
 	if resp.Err != nil {
 		resp.Logger.Error().Err(resp.Err).Str("action", c.method).Str("id", id).Msg("update failed")
 		return resp.Body, resp.Err
 	}
 
-	if isHttpStatusCodeOK(resp.Code) {
-		return resp.Body, nil
-	}
-
-	err := fmt.Errorf("statusCode[%d], body[%s]", resp.Code, string(resp.Body))
-	resp.Logger.Error().Err(err).Str("action", c.method).Str("id", id).Send()
-	return resp.Body, err
+	return resp.Body, nil
 }
 
 func (c *CouchDBClient) DeleteById(ctx context.Context, id, rev string) error {
@@ -238,26 +264,20 @@ func (c *CouchDBClient) DeleteById(ctx context.Context, id, rev string) error {
 	authHeader := c.basicAuth()
 
 	cReq := &httpclient.ClientRequest{
-		Ctx:     ctx,
-		Url:     url,
-		Headers: authHeader,
-		Debug:   true,
+		Ctx:          ctx,
+		Url:          url,
+		Headers:      authHeader,
+		FailOnNon2xx: true,
+		Debug:        true,
 	}
 
-	resp := httpclient.Delete(cReq)
+	resp := c.client.Delete(cReq)
 	if resp.Err != nil {
 		resp.Logger.Error().Err(resp.Err).Str("action", c.method).Str("id", id).Msg("delete failed")
 		return resp.Err
 	}
 
-	if isHttpStatusCodeOK(resp.Code) {
-		return nil
-	}
-
-	// error occurred
-	err := fmt.Errorf("statusCode[%d], body[%s]", resp.Code, string(resp.Body))
-	resp.Logger.Error().Err(err).Str("action", c.method).Str("id", id).Send()
-	return err
+	return nil
 }
 
 func (c *CouchDBClient) GetById(ctx context.Context, id string, v interface{}) ([]byte, error) {
@@ -266,30 +286,25 @@ func (c *CouchDBClient) GetById(ctx context.Context, id string, v interface{}) (
 	authHeader := c.basicAuth()
 
 	cReq := &httpclient.ClientRequest{
-		Ctx:     ctx,
-		Url:     url,
-		Headers: authHeader,
-		V:       v,
-		Debug:   true,
-	}
-
-	resp := httpclient.Get(cReq)
-	if resp.Err != nil {
-		resp.Logger.Error().Err(resp.Err).Str("action", c.method).Str("id", id).Msg("get failed")
-		return resp.Body, resp.Err
+		Ctx:          ctx,
+		Url:          url,
+		Headers:      authHeader,
+		V:            v,
+		FailOnNon2xx: true,
+		Debug:        true,
 	}
 
-	if resp.Code == http.StatusNotFound {
+	resp := c.client.Get(cReq)
+	if httpclient.IsStatusCode(resp.Err, http.StatusNotFound) {
 		return resp.Body, NoIdData
 	}
 
-	if isHttpStatusCodeOK(resp.Code) {
-		return resp.Body, nil
+	if resp.Err != nil {
+		resp.Logger.Error().Err(resp.Err).Str("action", c.method).Str("id", id).Msg("get failed")
+		return resp.Body, resp.Err
 	}
 
-	err := fmt.Errorf("statusCode[%d], body[%s]", resp.Code, string(resp.Body))
-	resp.Logger.Error().Err(err).Str("action", c.method).Str("id", id).Send()
-	return resp.Body, err
+	return resp.Body, nil
 }
 
 type SearchRequest struct {
@@ -340,33 +355,28 @@ func (c *CouchDBClient) Search(ctx context.Context, searchReq *SearchRequest, v
 	}
 
 	req := &httpclient.ClientRequest{
-		Ctx:     ctx,
-		Url:     url,
-		Headers: authHeaders,
-		Body:    data,
-		Timeout: 30,
-		V:       v,
-		Debug:   true,
+		Ctx:          ctx,
+		Url:          url,
+		Headers:      authHeaders,
+		Body:         data,
+		Timeout:      30,
+		V:            v,
+		FailOnNon2xx: true,
+		Debug:        true,
 	}
 
-	resp := httpclient.Post(req)
+	resp := c.client.Post(req)
 	if resp.Err != nil {
 		resp.Logger.Error().Err(resp.Err).Str("action", c.method).Send()
 		return nil, resp.Err
 	}
 
-	if isHttpStatusCodeOK(resp.Code) {
-		// parse data
-		var sr *SearchResponse
-		err = json.Unmarshal(resp.Body, &sr)
-		if err != nil {
-			resp.Logger.Error().Err(err).Str("action", c.method).Msg("unmarshal search result failed")
-			return nil, err
-		}
-		return sr, nil
+	// parse data
+	var sr *SearchResponse
+	err = json.Unmarshal(resp.Body, &sr)
+	if err != nil {
+		resp.Logger.Error().Err(err).Str("action", c.method).Msg("unmarshal search result failed")
+		return nil, err
 	}
-
-	err = fmt.Errorf("statusCode[%d], body[%s]", resp.Code, string(resp.Body))
-	resp.Logger.Error().Err(err).Str("action", c.method).Send()
-	return nil, err
+	return sr, nil
 }
@@ -189,3 +189,15 @@ func TestClient_DeleteById(t *testing.T) {
 	}
 
 }
+
+func TestNewClientInvalidHostPorts(t *testing.T) {
+	_, err := NewClient(&CouchDBOption{HostPorts: []string{"localhost:5984", "bad host:5984"}}, couchdbName)
+	if err == nil {
+		t.Fatal("expect error of invalid hostPorts")
+	}
+	t.Log(err)
+
+	if _, err := NewClient(&CouchDBOption{HostPorts: []string{"n1:5984", "n2:5984"}}, couchdbName); err != nil {
+		t.Error(err)
+	}
+}
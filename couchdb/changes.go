@@ -0,0 +1,138 @@
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/leyle/go-api-starter/httpclient"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultHeartbeat = 30 * time.Second
+
+// Seq is update sequence, a string since couchdb 2.x, a number in 1.x
+type Seq string
+
+func (s *Seq) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = Seq(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return fmt.Errorf("invalid seq: %s", data)
+	}
+	*s = Seq(num.String())
+	return nil
+}
+
+type ChangesOption struct {
+	// "now", or Seq of the last handled change, empty means from the beginning
+	Since string
+
+	IncludeDocs bool
+
+	// mango selector, only changes of matched docs are sent
+	Selector interface{}
+
+	// empty lines are sent by couchdb to keep the connection, default is 30s
+	Heartbeat time.Duration
+}
+
+type Change struct {
+	Seq     Seq    `json:"seq"`
+	Id      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+	Changes []struct {
+		Rev string `json:"rev"`
+	} `json:"changes"`
+
+	// set if ChangesOption.IncludeDocs is true
+	Doc json.RawMessage `json:"doc,omitempty"`
+}
+
+type ChangesFeed struct {
+	C   <-chan *Change
+	err error
+}
+
+// Err returns why the feed stopped, nil if ctx is done.
+// it is valid after C is closed
+func (f *ChangesFeed) Err() error {
+	return f.err
+}
+
+func (c *CouchDBClient) changesURL() string {
+	return fmt.Sprintf("%s/%s", c.dbURL(), "_changes")
+}
+
+// Changes follows continuous changes feed of database until ctx is done,
+// it does not reconnect, restart it with Since of the last handled change
+func (c *CouchDBClient) Changes(ctx context.Context, opt *ChangesOption) *ChangesFeed {
+	c.method = "Changes"
+	heartbeat := opt.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	query := map[string][]string{
+		"feed":      {"continuous"},
+		"heartbeat": {strconv.FormatInt(heartbeat.Milliseconds(), 10)},
+	}
+	if opt.Since != "" {
+		query["since"] = []string{opt.Since}
+	}
+	if opt.IncludeDocs {
+		query["include_docs"] = []string{"true"}
+	}
+
+	// canceled when decoding fails, so the stream is released
+	ctx, cancel := context.WithCancel(ctx)
+	req := &httpclient.ClientRequest{
+		Ctx:     ctx,
+		Url:     c.changesURL(),
+		Query:   query,
+		Headers: c.basicAuth(),
+	}
+	method := http.MethodGet
+	if opt.Selector != nil {
+		query["filter"] = []string{"_selector"}
+		req.Body, _ = json.Marshal(map[string]interface{}{"selector": opt.Selector})
+		method = http.MethodPost
+	}
+
+	ch := make(chan *Change)
+	feed := &ChangesFeed{C: ch}
+	stream := c.client.NDJSON(req, method)
+
+	go func() {
+		defer close(ch)
+		defer cancel()
+		for line := range stream.C {
+			change := &Change{}
+			if err := json.Unmarshal(line, change); err != nil {
+				feed.err = err
+				cancel()
+				break
+			}
+			if change.Id == "" {
+				// last_seq line sent before couchdb closes the feed
+				continue
+			}
+			select {
+			case ch <- change:
+			case <-ctx.Done():
+			}
+		}
+		for range stream.C {
+		}
+		if feed.err == nil {
+			feed.err = stream.Err()
+		}
+	}()
+
+	return feed
+}
@@ -0,0 +1,97 @@
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/leyle/go-api-starter/httpclient"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func mockChangesClient(body string) (*CouchDBClient, *httpclient.MockTransport) {
+	mock := httpclient.NewMockTransport().On("", "/dev/_changes", http.StatusOK, body)
+	client := New(opt, couchdbName)
+	client.client = httpclient.NewClient(&httpclient.ClientOption{Transport: mock})
+	return client, mock
+}
+
+func readChanges(t *testing.T, feed *ChangesFeed) []*Change {
+	var changes []*Change
+	for change := range feed.C {
+		changes = append(changes, change)
+	}
+	if err := feed.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func TestChanges(t *testing.T) {
+	body := `{"seq":12,"id":"doc1","changes":[{"rev":"1-a"}]}` + "\n" +
+		"\n" +
+		`{"seq":"13-g1AAAABteJzLYWBgYMpgTmHgz8tPSTV0MDQy","id":"doc2","deleted":true,"changes":[{"rev":"2-b"}]}` + "\n" +
+		`{"last_seq":"13-g1AAAABteJzLYWBgYMpgTmHgz8tPSTV0MDQy","pending":0}` + "\n"
+	client, mock := mockChangesClient(body)
+
+	changes := readChanges(t, client.Changes(context.Background(), &ChangesOption{}))
+	if len(changes) != 2 {
+		t.Fatalf("expect 2 changes without last_seq, got %d", len(changes))
+	}
+	if changes[0].Seq != "12" || changes[0].Id != "doc1" || changes[0].Changes[0].Rev != "1-a" {
+		t.Errorf("unexpected numeric seq change: %+v", changes[0])
+	}
+	if changes[1].Seq != "13-g1AAAABteJzLYWBgYMpgTmHgz8tPSTV0MDQy" || !changes[1].Deleted {
+		t.Errorf("unexpected string seq change: %+v", changes[1])
+	}
+
+	call := mock.Calls()[0]
+	u, _ := url.Parse(call.Url)
+	q := u.Query()
+	if call.Method != http.MethodGet || q.Get("feed") != "continuous" || q.Get("heartbeat") != "30000" || q.Get("since") != "" {
+		t.Errorf("unexpected request: %s %s", call.Method, call.Url)
+	}
+
+	// resume from the last handled change
+	client, mock = mockChangesClient(`{"seq":14,"id":"doc3","changes":[{"rev":"1-c"}],"doc":{"_id":"doc3","name":"jack"}}` + "\n")
+	changes = readChanges(t, client.Changes(context.Background(), &ChangesOption{
+		Since:       string(changes[1].Seq),
+		IncludeDocs: true,
+	}))
+	if len(changes) != 1 || string(changes[0].Doc) != `{"_id":"doc3","name":"jack"}` {
+		t.Errorf("unexpected resumed changes: %+v", changes)
+	}
+	u, _ = url.Parse(mock.Calls()[0].Url)
+	if q := u.Query(); q.Get("since") != "13-g1AAAABteJzLYWBgYMpgTmHgz8tPSTV0MDQy" || q.Get("include_docs") != "true" {
+		t.Errorf("unexpected resume request: %s", mock.Calls()[0].Url)
+	}
+}
+
+func TestChangesSelector(t *testing.T) {
+	client, mock := mockChangesClient(`{"seq":1,"id":"doc1","changes":[{"rev":"1-a"}]}` + "\n")
+	readChanges(t, client.Changes(context.Background(), &ChangesOption{
+		Selector: map[string]interface{}{"type": "user"},
+	}))
+
+	call := mock.Calls()[0]
+	u, _ := url.Parse(call.Url)
+	if call.Method != http.MethodPost || u.Query().Get("filter") != "_selector" {
+		t.Errorf("unexpected selector request: %s %s", call.Method, call.Url)
+	}
+	var body map[string]map[string]string
+	if err := json.Unmarshal(call.Body, &body); err != nil || body["selector"]["type"] != "user" {
+		t.Errorf("unexpected selector body: %s", call.Body)
+	}
+}
+
+func TestChangesInvalidLine(t *testing.T) {
+	client, _ := mockChangesClient(`{"seq":1,"id":"doc1"}` + "\n" + `{"seq":{},"id":"doc2"}` + "\n")
+	feed := client.Changes(context.Background(), &ChangesOption{})
+	n := 0
+	for range feed.C {
+		n++
+	}
+	if n != 1 || feed.Err() == nil {
+		t.Errorf("expect decode error after 1 change, got %d %v", n, feed.Err())
+	}
+}
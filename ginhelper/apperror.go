@@ -0,0 +1,136 @@
+package ginhelper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+// AppError is an error returned to client, thrown by StopExec or passed to HandleError.
+// it is recognized through wrapping, e.g. fmt.Errorf("create user: %w", ErrConflict(4091, "name is taken"))
+type AppError struct {
+	// http status code, invalid one is treated as 500
+	Status int
+
+	// business code in response body
+	Code int
+
+	// message in response body
+	Msg string
+
+	// data in response body, e.g. invalid fields
+	Details interface{}
+
+	// internal error, logged by request logger but never returned to client
+	Cause error
+}
+
+// Error is in legacy "code|msg" format, Cause is left out so ParseCustomErr can not return it to client
+func (e *AppError) Error() string {
+	return fmt.Sprintf("%d|%s", e.Code, e.Msg)
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Cause
+}
+
+// WithDetails returns a copy of e with details
+func (e *AppError) WithDetails(details interface{}) *AppError {
+	t := *e
+	t.Details = details
+	return &t
+}
+
+// WithCause returns a copy of e with internal cause
+func (e *AppError) WithCause(cause error) *AppError {
+	t := *e
+	t.Cause = cause
+	return &t
+}
+
+// NewAppError, code 0 means status * 10, e.g. 4040 for 404
+func NewAppError(status, code int, msg string) *AppError {
+	if code == 0 {
+		code = status * 10
+	}
+	return &AppError{
+		Status: status,
+		Code:   code,
+		Msg:    msg,
+	}
+}
+
+func ErrBadRequest(code int, msg string) *AppError {
+	return NewAppError(http.StatusBadRequest, code, msg)
+}
+
+func ErrUnauthorized(code int, msg string) *AppError {
+	return NewAppError(http.StatusUnauthorized, code, msg)
+}
+
+func ErrForbidden(code int, msg string) *AppError {
+	return NewAppError(http.StatusForbidden, code, msg)
+}
+
+func ErrNotFound(code int, msg string) *AppError {
+	return NewAppError(http.StatusNotFound, code, msg)
+}
+
+func ErrConflict(code int, msg string) *AppError {
+	return NewAppError(http.StatusConflict, code, msg)
+}
+
+func ErrUnprocessable(code int, msg string) *AppError {
+	return NewAppError(http.StatusUnprocessableEntity, code, msg)
+}
+
+// ErrInternal hides cause from client behind a generic message
+func ErrInternal(cause error) *AppError {
+	return &AppError{
+		Status: http.StatusInternalServerError,
+		Code:   DefaultInternalErrCode,
+		Msg:    DefaultInternalErrMsg,
+		Cause:  cause,
+	}
+}
+
+const DefaultInternalErrCode = 5000
+const DefaultInternalErrMsg = "internal server error"
+
+// PlainErrAsInternal changes how AsAppError treats plain errors,
+// those are neither AppError, CustomErrStruct nor in "code|msg" format.
+// false, the default, keeps the legacy behavior: 400 with DefaultCustomErrCode and err message.
+// true returns 500 with DefaultInternalErrMsg, err is logged but hidden from client
+var PlainErrAsInternal = false
+
+// AsAppError finds the AppError in err chain.
+// CustomErrStruct and legacy "code|msg" errors are 400,
+// runtime errors, e.g. nil pointer dereference, are internal errors,
+// other errors depend on PlainErrAsInternal
+func AsAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		if http.StatusText(appErr.Status) == "" {
+			t := *appErr
+			t.Status = http.StatusInternalServerError
+			return &t
+		}
+		return appErr
+	}
+
+	var customErr *CustomErrStruct
+	if errors.As(err, &customErr) {
+		return ErrBadRequest(customErr.Code, customErr.Msg)
+	}
+
+	if cerr, ok := parseLegacyErr(err); ok {
+		return ErrBadRequest(cerr.Code, cerr.Msg)
+	}
+
+	var rerr runtime.Error
+	if PlainErrAsInternal || errors.As(err, &rerr) {
+		return ErrInternal(err)
+	}
+	return ErrBadRequest(DefaultCustomErrCode, err.Error())
+}
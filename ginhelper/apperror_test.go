@@ -0,0 +1,136 @@
+package ginhelper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAppError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	e := gin.New()
+	e.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+		c.Next()
+	})
+	e.Use(RecoveryMiddleware(DefaultStopExecHandler))
+
+	PlainErrAsInternal = true
+	defer func() {
+		PlainErrAsInternal = false
+	}()
+
+	dbErr := errors.New("dial tcp 10.0.0.8:5432: connection refused")
+	errs := map[string]error{
+		"notfound":     ErrNotFound(4041, "user not found"),
+		"conflict":     fmt.Errorf("create user: %w", ErrConflict(0, "name is taken").WithCause(dbErr)),
+		"invalid":      ErrUnprocessable(4221, "invalid fields").WithDetails(map[string]string{"age": "too young"}),
+		"internal":     fmt.Errorf("query: %w", dbErr),
+		"wrapped":      ErrInternal(dbErr),
+		"badstatus":    &AppError{Status: 999, Code: 1, Msg: "oops"},
+		"custom":       fmt.Errorf("wrap: %w", &CustomErrStruct{Code: 4002, Msg: "bad name"}),
+		"legacy":       errors.New("4001|name is required"),
+		"unauthorized": ErrUnauthorized(0, "login required"),
+	}
+	e.GET("/:name", func(c *gin.Context) {
+		StopExec(errs[c.Param("name")])
+	})
+
+	cases := []struct {
+		name   string
+		status int
+		code   int
+		msg    string
+	}{
+		{"notfound", 404, 4041, "user not found"},
+		{"conflict", 409, 4090, "name is taken"},
+		{"invalid", 422, 4221, "invalid fields"},
+		{"internal", 500, DefaultInternalErrCode, DefaultInternalErrMsg},
+		{"wrapped", 500, DefaultInternalErrCode, DefaultInternalErrMsg},
+		{"badstatus", 500, 1, "oops"},
+		{"custom", 400, 4002, "bad name"},
+		{"legacy", 400, 4001, "name is required"},
+		{"unauthorized", 401, 4010, "login required"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tc.name, nil))
+		var ret ReturnClientDataForm
+		if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+			t.Fatalf("%s: invalid response %s", tc.name, w.Body.String())
+		}
+		if w.Code != tc.status || ret.Code != tc.code || ret.Msg != tc.msg {
+			t.Errorf("%s: unexpected response %d %s", tc.name, w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), "10.0.0.8") {
+			t.Errorf("%s: internal cause leaked to client: %s", tc.name, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/invalid", nil))
+	if !strings.Contains(w.Body.String(), `"data":{"age":"too young"}`) {
+		t.Errorf("details should be returned: %s", w.Body.String())
+	}
+
+	// causes are logged, client errors without cause are not
+	logs := buf.String()
+	if strings.Count(logs, "connection refused") != 3 || strings.Contains(logs, "user not found") {
+		t.Errorf("unexpected logs: %s", logs)
+	}
+	if !strings.Contains(logs, `"level":"warn"`) || !strings.Contains(logs, `"level":"error"`) {
+		t.Errorf("unexpected log levels: %s", logs)
+	}
+}
+
+func TestAppErrorLegacy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(RecoveryMiddleware(DefaultStopExecHandler))
+	e.GET("/plain", func(c *gin.Context) {
+		StopExec(errors.New("should stop"))
+	})
+	e.GET("/nocode", func(c *gin.Context) {
+		StopExec(errors.New("abc|name is required"))
+	})
+	e.GET("/nil", func(c *gin.Context) {
+		var m map[string]int
+		m["a"] = 1
+	})
+
+	// plain error keeps the legacy response by default
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plain", nil))
+	if w.Code != 400 || !strings.Contains(w.Body.String(), `"code":4000,"msg":"should stop"`) {
+		t.Errorf("unexpected plain error response: %d %s", w.Code, w.Body.String())
+	}
+
+	// non numeric code is split as before
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nocode", nil))
+	if w.Code != 400 || !strings.Contains(w.Body.String(), `"code":4000,"msg":"name is required"`) {
+		t.Errorf("unexpected non numeric code response: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nil", nil))
+	if w.Code != 500 || strings.Contains(w.Body.String(), "nil map") {
+		t.Errorf("unexpected runtime error response: %d %s", w.Code, w.Body.String())
+	}
+
+	// cause is not in legacy format
+	cerr := ParseCustomErr(fmt.Errorf("wrap: %w", ErrConflict(4091, "name is taken").WithCause(errors.New("10.0.0.8"))))
+	if strings.Contains(cerr.Msg, "10.0.0.8") {
+		t.Errorf("cause leaked by ParseCustomErr: %s", cerr.Msg)
+	}
+}
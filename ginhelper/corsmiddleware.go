@@ -2,10 +2,17 @@ package ginhelper
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/leyle/go-api-starter/logmiddleware"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-var allowHeaders = []string{
+var defaultAllowHeaders = []string{
 	"Content-Type",
 	"TOKEN",
 	"X-TOKEN",
@@ -17,27 +24,273 @@ var allowHeaders = []string{
 	"origin",
 	"Cache-Control",
 	"X-Requested-With",
+	logmiddleware.ReqIdHeaderName,
 }
 
+var defaultAllowMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+type CORSConfig struct {
+	// exact origins, e.g. "https://app.example.com",
+	// wildcard subdomains, e.g. "https://*.example.com", or "*" for any origin
+	AllowOrigins []string
+
+	// regular expressions matched against the whole origin, e.g. `^https://pr-\d+\.preview\.example\.com$`
+	AllowOriginPatterns []string
+
+	// called when origin is not matched by AllowOrigins and AllowOriginPatterns
+	AllowOriginFunc func(origin string) bool
+
+	// default is GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS
+	AllowMethods []string
+
+	// request headers allowed in preflight, default is the common ones plus X-REQ-ID
+	AllowHeaders []string
+
+	// response headers readable by browser scripts, default is X-REQ-ID
+	ExposeHeaders []string
+
+	// allows cookies and Authorization, the matched origin is reflected instead of "*"
+	AllowCredentials bool
+
+	// how long browsers cache preflight result, 0 omits Access-Control-Max-Age
+	MaxAge time.Duration
+}
+
+// DefaultCORSConfig is used by CORSMiddleware, it allows any origin without credentials
+var DefaultCORSConfig = &CORSConfig{
+	AllowOrigins: []string{"*"},
+}
+
+// added by AddAllowHeaders, read on every preflight request
+var (
+	extraAllowHeaders   []string
+	extraAllowHeadersMu sync.RWMutex
+)
+
+// AddAllowHeaders adds a request header to policies using the default AllowHeaders,
+// it takes effect on middlewares already built, e.g. the one of SetupGin.
+//
+// Deprecated: set CORSConfig.AllowHeaders instead
 func AddAllowHeaders(val string) {
-	allowHeaders = append(allowHeaders, val)
+	extraAllowHeadersMu.Lock()
+	defer extraAllowHeadersMu.Unlock()
+	extraAllowHeaders = append(extraAllowHeaders, val)
 }
 
-func getAllowHeaders() string {
-	return strings.Join(allowHeaders, ",")
+func getExtraAllowHeaders() []string {
+	extraAllowHeadersMu.RLock()
+	defer extraAllowHeadersMu.RUnlock()
+	return extraAllowHeaders
 }
 
 func CORSMiddleware() gin.HandlerFunc {
+	return NewCORSMiddleware(DefaultCORSConfig)
+}
+
+// NewCORSMiddleware panics if an AllowOriginPatterns item is not a valid regular expression.
+// preflight requests must reach it, so use it on engine, or use CORSGroupMiddleware for route groups
+func NewCORSMiddleware(cfg *CORSConfig) gin.HandlerFunc {
+	policy := newCORSPolicy(cfg)
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", getAllowHeaders())
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, HEAD, CONNECT, TRACE, PATCH")
+		policy.handle(c)
+	}
+}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(200)
-			return
+// CORSGroupMiddleware applies policy of the route group, used on engine.
+// key is base path of route group, e.g. "/api/v1", the longest matched one is used,
+// "/" is the default policy, requests without matched policy get no CORS headers
+func CORSGroupMiddleware(policies map[string]*CORSConfig) gin.HandlerFunc {
+	type groupPolicy struct {
+		prefix string
+		policy *corsPolicy
+	}
+	groups := make([]*groupPolicy, 0, len(policies))
+	for prefix, cfg := range policies {
+		groups = append(groups, &groupPolicy{
+			prefix: strings.TrimSuffix(prefix, "/"),
+			policy: newCORSPolicy(cfg),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return len(groups[i].prefix) > len(groups[j].prefix)
+	})
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, g := range groups {
+			if g.prefix == "" || path == g.prefix || strings.HasPrefix(path, g.prefix+"/") {
+				g.policy.handle(c)
+				return
+			}
 		}
 		c.Next()
 	}
 }
+
+type corsPolicy struct {
+	anyOrigin    bool
+	origins      map[string]bool
+	wildcards    []*wildcardOrigin
+	patterns     []*regexp.Regexp
+	originFunc   func(origin string) bool
+	methods      map[string]bool
+	allowMethods string
+	allowHeaders string
+	// AllowHeaders is not set, headers of AddAllowHeaders are appended
+	defaultHeaders bool
+	exposeHeaders  string
+	credentials    bool
+	maxAge         string
+}
+
+// "https://*.example.com" matches subdomains of example.com with https scheme
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+}
+
+func newCORSPolicy(cfg *CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		origins:     make(map[string]bool),
+		originFunc:  cfg.AllowOriginFunc,
+		methods:     make(map[string]bool),
+		credentials: cfg.AllowCredentials,
+	}
+
+	for _, origin := range cfg.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		if i := strings.Index(origin, "://*."); i > 0 {
+			p.wildcards = append(p.wildcards, &wildcardOrigin{scheme: origin[:i], suffix: origin[i+4:]})
+			continue
+		}
+		p.origins[origin] = true
+	}
+	for _, pattern := range cfg.AllowOriginPatterns {
+		p.patterns = append(p.patterns, regexp.MustCompile(pattern))
+	}
+
+	methods := cfg.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultAllowMethods
+	}
+	upper := make([]string, 0, len(methods))
+	for _, m := range methods {
+		m = strings.ToUpper(m)
+		upper = append(upper, m)
+		p.methods[m] = true
+	}
+	p.allowMethods = strings.Join(upper, ", ")
+
+	headers := cfg.AllowHeaders
+	if len(headers) == 0 {
+		headers = defaultAllowHeaders
+		p.defaultHeaders = true
+	}
+	p.allowHeaders = strings.Join(headers, ", ")
+
+	expose := cfg.ExposeHeaders
+	if len(expose) == 0 {
+		expose = []string{logmiddleware.ReqIdHeaderName}
+	}
+	p.exposeHeaders = strings.Join(expose, ", ")
+
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	return p
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if p.origins[lower] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if strings.HasPrefix(lower, w.scheme+"://") && strings.HasSuffix(lower, w.suffix) &&
+			len(lower) > len(w.scheme)+3+len(w.suffix) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return p.originFunc != nil && p.originFunc(origin)
+}
+
+func (p *corsPolicy) handle(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		// not a cross origin request
+		corsNext(c)
+		return
+	}
+
+	header := c.Writer.Header()
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+	header.Add("Vary", "Origin")
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	if !p.allowOrigin(origin) {
+		if preflight {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		// without CORS headers, browser blocks the response
+		corsNext(c)
+		return
+	}
+
+	if p.anyOrigin && !p.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if preflight {
+		if !p.methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		header.Set("Access-Control-Allow-Methods", p.allowMethods)
+		allowHeaders := p.allowHeaders
+		if extra := getExtraAllowHeaders(); p.defaultHeaders && len(extra) > 0 {
+			allowHeaders += ", " + strings.Join(extra, ", ")
+		}
+		header.Set("Access-Control-Allow-Headers", allowHeaders)
+		if p.maxAge != "" {
+			header.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	header.Set("Access-Control-Expose-Headers", p.exposeHeaders)
+	corsNext(c)
+}
+
+// OPTIONS requests other than preflight are answered 200 and never reach routes, as before
+func corsNext(c *gin.Context) {
+	if c.Request.Method == http.MethodOptions {
+		c.AbortWithStatus(http.StatusOK)
+		return
+	}
+	c.Next()
+}
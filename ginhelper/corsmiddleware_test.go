@@ -0,0 +1,139 @@
+package ginhelper
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func corsRequest(e *gin.Engine, method, path, origin, reqMethod string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if reqMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", reqMethod)
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(NewCORSMiddleware(&CORSConfig{
+		AllowOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowOriginPatterns: []string{`^https://pr-\d+\.preview\.example\.net$`},
+		AllowOriginFunc: func(origin string) bool {
+			return origin == "http://localhost:3000"
+		},
+		AllowMethods:     []string{"get", "post"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	e.GET("/users", func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+
+	for _, origin := range []string{"https://app.example.com", "https://a.b.example.org", "https://pr-12.preview.example.net", "http://localhost:3000"} {
+		w := corsRequest(e, http.MethodGet, "/users", origin, "")
+		if w.Code != 200 || w.Header().Get("Access-Control-Allow-Origin") != origin ||
+			w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+			w.Header().Get("Access-Control-Expose-Headers") != "X-REQ-ID" ||
+			w.Header().Get("Vary") != "Origin" {
+			t.Errorf("%s should be allowed: %d %v", origin, w.Code, w.Header())
+		}
+	}
+
+	for _, origin := range []string{"https://evil.com", "https://example.org", "http://app.example.com", "https://pr-x.preview.example.net"} {
+		w := corsRequest(e, http.MethodGet, "/users", origin, "")
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s should not be allowed", origin)
+		}
+	}
+
+	w := corsRequest(e, http.MethodOptions, "/users", "https://app.example.com", "POST")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "GET, POST" ||
+		w.Header().Get("Access-Control-Max-Age") != "600" ||
+		!strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), "X-REQ-ID") {
+		t.Errorf("unexpected preflight response: %d %v", w.Code, w.Header())
+	}
+
+	if w := corsRequest(e, http.MethodOptions, "/users", "https://app.example.com", "DELETE"); w.Code != http.StatusForbidden {
+		t.Errorf("disallowed method preflight should be rejected, got %d", w.Code)
+	}
+	if w := corsRequest(e, http.MethodOptions, "/users", "https://evil.com", "GET"); w.Code != http.StatusForbidden {
+		t.Errorf("disallowed origin preflight should be rejected, got %d", w.Code)
+	}
+}
+
+func TestCORSMiddlewareDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(CORSMiddleware())
+	e.GET("/", func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+
+	w := corsRequest(e, http.MethodGet, "/", "https://any.site", "")
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("default policy should allow any origin without credentials: %v", w.Header())
+	}
+
+	// OPTIONS without preflight headers does not reach routes
+	for _, origin := range []string{"", "https://any.site"} {
+		if w := corsRequest(e, http.MethodOptions, "/", origin, ""); w.Code != http.StatusOK {
+			t.Errorf("bare OPTIONS with origin %q should be answered 200, got %d", origin, w.Code)
+		}
+	}
+}
+
+func TestCORSAddAllowHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(CORSMiddleware())
+	e.GET("/", func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+
+	// added after the middleware is built
+	AddAllowHeaders("X-Tenant-Id")
+	defer func() {
+		extraAllowHeaders = nil
+	}()
+
+	w := corsRequest(e, http.MethodOptions, "/", "https://any.site", "GET")
+	if !strings.HasSuffix(w.Header().Get("Access-Control-Allow-Headers"), ", X-Tenant-Id") {
+		t.Errorf("added header should be allowed: %v", w.Header())
+	}
+}
+
+func TestCORSGroupMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(CORSGroupMiddleware(map[string]*CORSConfig{
+		"/":          {AllowOrigins: []string{"*"}},
+		"/api/admin": {AllowOrigins: []string{"https://admin.example.com"}, AllowCredentials: true},
+	}))
+	e.GET("/api/admin/users", func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+	e.GET("/api/administrators", func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+
+	w := corsRequest(e, http.MethodOptions, "/api/admin/users", "https://admin.example.com", "GET")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://admin.example.com" {
+		t.Errorf("admin policy should be used: %d %v", w.Code, w.Header())
+	}
+	if w := corsRequest(e, http.MethodGet, "/api/admin/users", "https://other.com", ""); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("admin policy should reject other origins")
+	}
+	if w := corsRequest(e, http.MethodGet, "/api/administrators", "https://other.com", ""); w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("default policy should be used for /api/administrators")
+	}
+}
@@ -40,9 +40,15 @@ func exampleHandler(ctx *ExampleContext) {
 	ctx.Log.Info().Str("type", "last").Msg("")
 }
 
+// upstream of httpClientHandler, an httpbin instance, e.g. docker run -p 8000:80 kennethreitz/httpbin
+var ExampleUpstreamUrl = "http://localhost:8000/get"
+
+// client of httpClientHandler, tests replace it with one replaying httpclient/testdata/httpbin.yaml
+var ExampleHttpClient = httpclient.DefaultClient
+
 func httpClientHandler(ctx *ExampleContext) {
 	// test gin middleware and httpclient api
-	url := "http://192.168.2.40:8000/get"
+	url := ExampleUpstreamUrl
 	query := make(map[string][]string)
 	query["name"] = []string{"jack", "telsa"}
 	query["age"] = []string{"12", "23"}
@@ -59,7 +65,7 @@ func httpClientHandler(ctx *ExampleContext) {
 		Debug:   true,
 	}
 
-	resp := httpclient.Get(cReq)
+	resp := ExampleHttpClient.Get(cReq)
 	if resp.Err != nil {
 		ctx.C.JSON(400, resp.Err.Error())
 		return
@@ -71,7 +77,7 @@ func httpClientHandler(ctx *ExampleContext) {
 
 func panicHandler(ctx *ExampleContext) {
 	err := errors.New("should stop")
-	StopExec(err)
+	StopExec(ErrConflict(4091, "already stopped").WithCause(err))
 }
 
 func ExampleMain() {
@@ -2,8 +2,12 @@ package ginhelper
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/leyle/go-api-starter/httpclient"
 	"github.com/leyle/go-api-starter/logmiddleware"
 	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -35,3 +39,24 @@ func ginHandler(c *gin.Context) {
 func TestExampleMain(t *testing.T) {
 	ExampleMain()
 }
+
+func TestExampleHttpClient(t *testing.T) {
+	cassette, err := httpclient.NewCassette("../httpclient/testdata/httpbin.yaml", httpclient.CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExampleHttpClient = httpclient.NewClient(&httpclient.ClientOption{Transport: cassette})
+	defer func() {
+		ExampleHttpClient = httpclient.DefaultClient
+	}()
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.GET("/get", HandlerWrapper(httpClientHandler, &ExampleContext{}))
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "telsa") {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
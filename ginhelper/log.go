@@ -7,40 +7,123 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/leyle/go-api-starter/logmiddleware"
 	"github.com/rs/zerolog"
+	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
+// used by GinLogMiddleware, read on every request.
+// Deprecated: use GinLogOption.PrintHeaders
 var PrintHeaders = false
 
-var ignoreReadReqBodyPath = []string{}
+var (
+	ignoreReadReqBodyPath   = []string{}
+	ignoreReadReqBodyPathMu sync.RWMutex
+)
 
+// AddIgnoreReadReqBodyPath skips request and response bodies of exact paths in GinLogMiddleware,
+// it takes effect on middlewares already built, e.g. the one of SetupGin.
+// Deprecated: use GinLogOption.Rules
 func AddIgnoreReadReqBodyPath(paths ...string) {
+	ignoreReadReqBodyPathMu.Lock()
+	defer ignoreReadReqBodyPathMu.Unlock()
 	ignoreReadReqBodyPath = append(ignoreReadReqBodyPath, paths...)
 }
 
 func isIgnoreReadBodyPath(reqPath string) bool {
-	for _, path := range ignoreReadReqBodyPath {
-		if reqPath == path {
+	ignoreReadReqBodyPathMu.RLock()
+	defer ignoreReadReqBodyPathMu.RUnlock()
+	for _, p := range ignoreReadReqBodyPath {
+		if reqPath == p {
 			return true
 		}
 	}
 	return false
 }
 
+// DefaultMaxLogBodySize is the max request / response body bytes written into log by default
+const DefaultMaxLogBodySize = 4096
+
+type GinLogOption struct {
+	// max request / response body bytes written into log, longer body is truncated with its full size,
+	// 0 means DefaultMaxLogBodySize, negative means no limit
+	MaxReqBodySize  int
+	MaxRespBodySize int
+
+	// log request headers
+	PrintHeaders bool
+
+	// skip bodies, headers or whole log entry of matched requests
+	Rules []*LogRule
+
+	// masks headers, query parameters and body fields of requests and responses,
+	// default is logmiddleware.DefaultRedactor
+	Redactor *logmiddleware.Redactor
+
+	// also follow package level PrintHeaders and AddIgnoreReadReqBodyPath, set by GinLogMiddleware
+	legacy bool
+}
+
+func bodyLimit(size int) int {
+	if size == 0 {
+		return DefaultMaxLogBodySize
+	}
+	return size
+}
+
 // rewrite Write()
 type respWriter struct {
 	gin.ResponseWriter
 	cache *bytes.Buffer
+	// max cached bytes, negative means no limit
+	limit int
+	total int
+}
+
+// caches at most limit+1 bytes, so truncation can be told
+func (r *respWriter) capture(b []byte) {
+	r.total += len(b)
+	if r.limit < 0 {
+		r.cache.Write(b)
+		return
+	}
+	if room := r.limit + 1 - r.cache.Len(); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		r.cache.Write(b)
+	}
 }
 
-// it will increase memory usage
 func (r *respWriter) Write(b []byte) (int, error) {
-	r.cache.Write(b)
+	r.capture(b)
 	return r.ResponseWriter.Write(b)
 }
 
+func (r *respWriter) WriteString(s string) (int, error) {
+	r.capture([]byte(s))
+	return r.ResponseWriter.WriteString(s)
+}
+
+// GinLogMiddleware uses package level PrintHeaders and AddIgnoreReadReqBodyPath settings,
+// they are read on every request
 func GinLogMiddleware(logger zerolog.Logger) gin.HandlerFunc {
+	return NewGinLogMiddleware(logger, &GinLogOption{legacy: true})
+}
+
+func NewGinLogMiddleware(logger zerolog.Logger, opt *GinLogOption) gin.HandlerFunc {
+	reqLimit := bodyLimit(opt.MaxReqBodySize)
+	respLimit := bodyLimit(opt.MaxRespBodySize)
+	redactor := opt.Redactor
+	if redactor == nil {
+		redactor = logmiddleware.DefaultRedactor
+	}
+
 	return func(c *gin.Context) {
 		startT := time.Now()
 		id := c.Request.Header.Get(logmiddleware.ReqIdHeaderName)
@@ -63,22 +146,34 @@ func GinLogMiddleware(logger zerolog.Logger) gin.HandlerFunc {
 		ctx = context.WithValue(ctx, logmiddleware.ReqIdContextName, id)
 		c.Request = c.Request.WithContext(ctx)
 
+		// write req id to response headers
+		c.Writer.Header().Set(logmiddleware.ReqIdHeaderName, id)
+
+		skip := matchLogRules(opt.Rules, opt.legacy, c)
+		if skip.log {
+			c.Next()
+			return
+		}
+
 		// print req logmiddleware
-		body := reqBody(c)
-		reqInfo := reqJson(c)
-		event := l.Debug().Str("type", "REQUEST").RawJSON("req", reqInfo).RawJSON("body", body)
-		if PrintHeaders {
-			headers, _ := json.Marshal(c.Request.Header)
+		reqInfo := reqJson(c, redactor)
+		event := l.Debug().Str("type", "REQUEST").RawJSON("req", reqInfo)
+		if !skip.reqBody {
+			body, total := reqBody(c, reqLimit)
+			logBody(event, body, reqLimit, total, c.Request.Header.Get("Content-Type"), redactor)
+		}
+		if (opt.PrintHeaders || (opt.legacy && PrintHeaders)) && !skip.headers {
+			headers, _ := json.Marshal(redactor.Header(c.Request.Header))
 			event.RawJSON("headers", headers)
 		}
 		event.Msg("")
 
-		// write req id to response headers
-		c.Writer.Header().Set(logmiddleware.ReqIdHeaderName, id)
-
-		c.Writer = &respWriter{
-			ResponseWriter: c.Writer,
-			cache:          bytes.NewBufferString(""),
+		if !skip.respBody {
+			c.Writer = &respWriter{
+				ResponseWriter: c.Writer,
+				cache:          bytes.NewBufferString(""),
+				limit:          respLimit,
+			}
 		}
 
 		c.Next()
@@ -90,8 +185,8 @@ func GinLogMiddleware(logger zerolog.Logger) gin.HandlerFunc {
 		if !ok {
 			// silently passed
 		} else {
-			if rw.cache.Len() > 0 && !isIgnoreReadBodyPath(c.Request.URL.Path) {
-				revent.RawJSON("body", rw.cache.Bytes())
+			if rw.cache.Len() > 0 {
+				logBody(revent, rw.cache.Bytes(), respLimit, rw.total, rw.Header().Get("Content-Type"), redactor)
 			}
 		}
 		latency := time.Since(startT)
@@ -99,8 +194,8 @@ func GinLogMiddleware(logger zerolog.Logger) gin.HandlerFunc {
 	}
 }
 
-func reqJson(c *gin.Context) []byte {
-	path := c.Request.RequestURI
+func reqJson(c *gin.Context, redactor *logmiddleware.Redactor) []byte {
+	path := redactor.URL(c.Request.URL)
 	method := c.Request.Method
 	ctype := c.Request.Header.Get("Content-Type")
 	clientIp := c.ClientIP()
@@ -115,14 +210,136 @@ func reqJson(c *gin.Context) []byte {
 	return bdata
 }
 
-func reqBody(c *gin.Context) []byte {
-	var err error
-	var body []byte
-	if c.Request.ContentLength > 0 && !isIgnoreReadBodyPath(c.Request.URL.Path) {
-		body, err = ioutil.ReadAll(c.Request.Body)
-		if err == nil {
-			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+// reqBody reads at most limit+1 bytes for logging, the handler still gets the whole body.
+// total is the full body size
+func reqBody(c *gin.Context, limit int) ([]byte, int) {
+	if c.Request.ContentLength <= 0 {
+		return nil, 0
+	}
+
+	// Content-Length is sent by client, never size a buffer by it
+	orig := c.Request.Body
+	var r io.Reader = orig
+	if limit >= 0 {
+		r = io.LimitReader(orig, int64(limit+1))
+	}
+	body, err := ioutil.ReadAll(r)
+	// handler reads what has been read, then the rest, it gets the same error if reading failed
+	c.Request.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), orig), Closer: orig}
+	if err != nil {
+		return nil, 0
+	}
+	total := int(c.Request.ContentLength)
+	if limit < 0 || len(body) <= limit {
+		// the whole body is read, it may be shorter than declared
+		total = len(body)
+	}
+	return body, total
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// logBody writes body by its content type, so the log line is always valid JSON:
+// JSON as JSON, text as string, multipart and binary as a summary.
+// body longer than limit is cut with a truncation marker, total is the full body size.
+// sensitive fields are masked by redactor
+func logBody(event *zerolog.Event, body []byte, limit, total int, contentType string, redactor *logmiddleware.Redactor) {
+	if len(body) == 0 {
+		return
+	}
+	truncated := limit >= 0 && len(body) > limit
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		event.Interface("body", multipartSummary(body, params["boundary"], total, truncated))
+	case isBinaryBody(mediaType, body, truncated):
+		event.Interface("body", &bodySummary{Type: "binary", ContentType: contentType, Size: total})
+	case !truncated && (isJSONType(mediaType) || mediaType == "") && json.Valid(body):
+		masked, _ := redactor.JSON(body)
+		event.RawJSON("body", masked)
+	default:
+		// cut before masking, masked values may change the length
+		text := logmiddleware.TruncateBody(body, limit, total)
+		marker := ""
+		if truncated {
+			i := strings.LastIndex(text, "...(truncated")
+			text, marker = text[:i], text[i:]
+		}
+		masked := []byte(text)
+		if mediaType == "application/x-www-form-urlencoded" {
+			masked = redactor.Form(masked)
+		}
+		// text or truncated JSON
+		masked = redactor.Partial(masked)
+		event.Str("body", string(masked)+marker)
+	}
+}
+
+func isJSONType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isTextType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), isJSONType(mediaType),
+		mediaType == "application/x-www-form-urlencoded", mediaType == "application/xml",
+		strings.HasSuffix(mediaType, "+xml"), mediaType == "application/javascript":
+		return true
+	}
+	return false
+}
+
+func isBinaryBody(mediaType string, body []byte, truncated bool) bool {
+	if mediaType != "" && !isTextType(mediaType) {
+		return true
+	}
+	if truncated {
+		// drop the last rune, it may be cut
+		cut := len(body) - 1
+		for i := 1; i < utf8.UTFMax && cut > 0 && !utf8.RuneStart(body[cut]); i++ {
+			cut--
+		}
+		body = body[:cut]
+	}
+	return logmiddleware.IsBinary(body)
+}
+
+type bodySummary struct {
+	Type        string         `json:"type"`
+	ContentType string         `json:"contentType,omitempty"`
+	Size        int            `json:"size"`
+	Partial     bool           `json:"partial,omitempty"`
+	Parts       []*partSummary `json:"parts,omitempty"`
+}
+
+type partSummary struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// multipartSummary lists part names and filenames found in body, partial is set if body is truncated
+func multipartSummary(body []byte, boundary string, total int, truncated bool) *bodySummary {
+	summary := &bodySummary{Type: "multipart", Size: total, Partial: truncated}
+	if boundary == "" {
+		return summary
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		p := &partSummary{Name: part.FormName()}
+		if p.Filename = part.FileName(); p.Filename != "" {
+			p.ContentType = part.Header.Get("Content-Type")
 		}
+		summary.Parts = append(summary.Parts, p)
 	}
-	return body
+	return summary
 }
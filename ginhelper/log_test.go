@@ -0,0 +1,309 @@
+package ginhelper
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/go-api-starter/logmiddleware"
+	"github.com/rs/zerolog"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve one request and return the parsed log lines
+func serveLogged(t *testing.T, opt *GinLogOption, setup func(e *gin.Engine), req *http.Request) (*httptest.ResponseRecorder, []map[string]interface{}) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	e := gin.New()
+	e.Use(NewGinLogMiddleware(logger, opt))
+	setup(e)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+
+	var lines []map[string]interface{}
+	if buf.Len() == 0 {
+		return w, lines
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var v map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("invalid log line %s: %v", line, err)
+		}
+		lines = append(lines, v)
+	}
+	return w, lines
+}
+
+func TestGinLogBodyLimit(t *testing.T) {
+	reqBody := `{"data":"` + strings.Repeat("a", 100) + `"}`
+	respBody := strings.Repeat("b", 50)
+
+	var received string
+	setup := func(e *gin.Engine) {
+		e.POST("/upload", func(c *gin.Context) {
+			data, _ := ioutil.ReadAll(c.Request.Body)
+			received = string(data)
+			c.String(200, respBody)
+		})
+	}
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(reqBody))
+	w, lines := serveLogged(t, &GinLogOption{MaxReqBodySize: 10, MaxRespBodySize: 20}, setup, req)
+
+	if received != reqBody || w.Body.String() != respBody {
+		t.Fatalf("handler should get the whole body: %s", received)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 log lines, got %d", len(lines))
+	}
+	if body := lines[0]["body"]; body != `{"data":"a...(truncated, total 111 bytes)` {
+		t.Errorf("unexpected request body log: %v", body)
+	}
+	if body := lines[1]["body"]; body != strings.Repeat("b", 20)+"...(truncated, total 50 bytes)" {
+		t.Errorf("unexpected response body log: %v", body)
+	}
+
+	// small body is logged as it is
+	setup = func(e *gin.Engine) {
+		e.POST("/upload", func(c *gin.Context) {
+			c.JSON(200, gin.H{"data": respBody})
+		})
+	}
+	req = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{"a":1}`))
+	_, lines = serveLogged(t, &GinLogOption{MaxRespBodySize: -1}, setup, req)
+	if body, ok := lines[0]["body"].(map[string]interface{}); !ok || body["a"] != float64(1) {
+		t.Errorf("unexpected request body log: %v", lines[0]["body"])
+	}
+	if body, ok := lines[1]["body"].(map[string]interface{}); !ok || body["data"] != respBody {
+		t.Errorf("unexpected response body log: %v", lines[1]["body"])
+	}
+}
+
+func TestGinLogNonJSONBody(t *testing.T) {
+	setup := func(e *gin.Engine) {
+		e.Any("/echo", func(c *gin.Context) {
+			data, _ := ioutil.ReadAll(c.Request.Body)
+			c.Data(200, c.Query("type"), data)
+		})
+	}
+
+	newReq := func(ctype, respType string, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/echo?type="+respType, strings.NewReader(body))
+		req.Header.Set("Content-Type", ctype)
+		return req
+	}
+
+	// form post and html response are strings
+	_, lines := serveLogged(t, &GinLogOption{}, setup, newReq("application/x-www-form-urlencoded", "text/html", "a=1&b=<p>"))
+	if lines[0]["body"] != "a=1&b=<p>" || lines[1]["body"] != "a=1&b=<p>" {
+		t.Errorf("unexpected text body log: %v %v", lines[0]["body"], lines[1]["body"])
+	}
+
+	// binary
+	_, lines = serveLogged(t, &GinLogOption{}, setup, newReq("application/octet-stream", "image/png", "\x89PNG\x00\x01"))
+	for _, line := range lines {
+		body, ok := line["body"].(map[string]interface{})
+		if !ok || body["type"] != "binary" || body["size"] != float64(6) {
+			t.Errorf("unexpected binary body log: %v", line["body"])
+		}
+	}
+
+	// multipart summary, truncated after the second part header
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("title", "avatar")
+	fw, _ := mw.CreateFormFile("file", "me.png")
+	fw.Write(bytes.Repeat([]byte{0x89, 0x00}, 500))
+	mw.Close()
+	req := newReq(mw.FormDataContentType(), "application/json", buf.String())
+	_, lines = serveLogged(t, &GinLogOption{MaxReqBodySize: 400, MaxRespBodySize: -1}, setup, req)
+	body, ok := lines[0]["body"].(map[string]interface{})
+	if !ok || body["type"] != "multipart" || body["size"] != float64(buf.Len()) || body["partial"] != true {
+		t.Fatalf("unexpected multipart body log: %v", lines[0]["body"])
+	}
+	parts, _ := json.Marshal(body["parts"])
+	if string(parts) != `[{"name":"title"},{"contentType":"application/octet-stream","filename":"me.png","name":"file"}]` {
+		t.Errorf("unexpected parts: %s", parts)
+	}
+	// declared as json but it is not
+	if _, ok := lines[1]["body"].(map[string]interface{}); !ok {
+		t.Errorf("invalid json response should be summarized as binary: %v", lines[1]["body"])
+	}
+
+	// no body
+	_, lines = serveLogged(t, &GinLogOption{}, setup, httptest.NewRequest(http.MethodGet, "/echo", nil))
+	if _, ok := lines[0]["body"]; ok {
+		t.Errorf("empty body should not be logged")
+	}
+}
+
+func TestGinLogRules(t *testing.T) {
+	opt := &GinLogOption{
+		PrintHeaders: true,
+		Rules: []*LogRule{
+			{Path: "/files/:id/upload", SkipReqBody: true},
+			{Path: "/internal/*", SkipRespBody: true, SkipHeaders: true},
+			{Path: "/api/*/health", SkipLog: true},
+			{Path: "/login", SkipHeaders: true},
+		},
+	}
+	setup := func(e *gin.Engine) {
+		handler := func(c *gin.Context) {
+			data, _ := ioutil.ReadAll(c.Request.Body)
+			c.Data(200, "text/plain", data)
+		}
+		e.POST("/files/:id/upload", handler)
+		e.POST("/internal/jobs/run", handler)
+		e.POST("/api/v1/health", handler)
+		e.POST("/login", handler)
+		e.POST("/other", handler)
+	}
+
+	cases := []struct {
+		path                           string
+		lines                          int
+		reqBody, respBody, withHeaders bool
+	}{
+		{"/files/42/upload", 2, false, true, true},
+		{"/internal/jobs/run", 2, true, false, false},
+		{"/api/v1/health", 0, false, false, false},
+		{"/login", 2, true, true, false},
+		{"/other", 2, true, true, true},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader("data"))
+		req.Header.Set("Content-Type", "text/plain")
+		w, lines := serveLogged(t, opt, setup, req)
+		if w.Body.String() != "data" || w.Header().Get("X-REQ-ID") == "" {
+			t.Errorf("%s: handler should not be affected", tc.path)
+		}
+		if tc.lines == 0 {
+			if len(lines) != 0 {
+				t.Errorf("%s: expect no log, got %v", tc.path, lines)
+			}
+			continue
+		}
+		_, reqBody := lines[0]["body"]
+		_, headers := lines[0]["headers"]
+		_, respBody := lines[1]["body"]
+		if reqBody != tc.reqBody || respBody != tc.respBody || headers != tc.withHeaders {
+			t.Errorf("%s: unexpected log lines %v", tc.path, lines)
+		}
+	}
+}
+
+func TestGinLogRedact(t *testing.T) {
+	setup := func(e *gin.Engine) {
+		e.POST("/login", func(c *gin.Context) {
+			c.JSON(200, gin.H{"user": "jack", "token": "resp-token-1"})
+		})
+		e.POST("/form", func(c *gin.Context) {
+			c.String(200, "ok")
+		})
+	}
+
+	body := `{"name":"jack","password":"req-passwd-1","profile":{"refresh_token":"req-token-2"}}`
+	req := httptest.NewRequest(http.MethodPost, "/login?token=query-token-3&page=1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer header-token-4")
+	_, lines := serveLogged(t, &GinLogOption{PrintHeaders: true}, setup, req)
+
+	// form body and truncated json body
+	req = httptest.NewRequest(http.MethodPost, "/form", strings.NewReader("name=jack&passwd=form-passwd-5"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, formLines := serveLogged(t, &GinLogOption{}, setup, req)
+	req = httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(`{"secret":"cut-secret-6","data":"`+strings.Repeat("a", 100)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	_, cutLines := serveLogged(t, &GinLogOption{MaxReqBodySize: 20}, setup, req)
+	lines = append(lines, formLines...)
+	lines = append(lines, cutLines...)
+
+	data, _ := json.Marshal(lines)
+	out := string(data)
+	for _, secret := range []string{"req-passwd-1", "req-token-2", "query-token-3", "header-token-4", "resp-token-1", "form-passwd-5", "cut-secret-6"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%s leaked in log: %s", secret, out)
+		}
+	}
+	if reqInfo, _ := lines[0]["req"].(map[string]interface{}); reqInfo["path"] != "/login?token=******&page=1" ||
+		formLines[0]["body"] != "name=jack&passwd=******" ||
+		cutLines[0]["body"] != `{"secret":"******"...(truncated, total 135 bytes)` {
+		t.Errorf("unexpected log lines: %s", out)
+	}
+
+	// custom redactor
+	req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"name":"jack","pin":"1234"}`))
+	_, lines = serveLogged(t, &GinLogOption{Redactor: &logmiddleware.Redactor{Fields: []string{"pin"}, Mask: "x"}}, setup, req)
+	if reqBody, _ := json.Marshal(lines[0]["body"]); string(reqBody) != `{"name":"jack","pin":"x"}` {
+		t.Errorf("unexpected body with custom redactor: %s", reqBody)
+	}
+}
+
+func TestGinLogLegacySettings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	e := gin.New()
+	e.Use(GinLogMiddleware(zerolog.New(&buf)))
+	e.POST("/:name", func(c *gin.Context) {
+		data, _ := ioutil.ReadAll(c.Request.Body)
+		c.Data(200, "text/plain", data)
+	})
+
+	// set after the middleware is built, e.g. by SetupGin
+	PrintHeaders = true
+	AddIgnoreReadReqBodyPath("/upload")
+	defer func() {
+		PrintHeaders = false
+		ignoreReadReqBodyPath = []string{}
+	}()
+
+	for _, path := range []string{"/upload", "/other"} {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("secret-data"))
+		req.Header.Set("Content-Type", "text/plain")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+
+		out := buf.String()
+		if !strings.Contains(out, `"headers":`) {
+			t.Errorf("%s: headers should be logged: %s", path, out)
+		}
+		if logged := strings.Contains(out, "secret-data"); logged != (path == "/other") {
+			t.Errorf("%s: unexpected body log: %s", path, out)
+		}
+	}
+}
+
+func TestGinLogDeclaredLength(t *testing.T) {
+	var received string
+	setup := func(e *gin.Engine) {
+		e.POST("/upload", func(c *gin.Context) {
+			data, _ := ioutil.ReadAll(c.Request.Body)
+			received = string(data)
+			c.String(200, "ok")
+		})
+	}
+
+	// a huge declared length with a short body must not allocate the declared size
+	for _, limit := range []int{-1, 0, 2} {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("abc"))
+		req.Header.Set("Content-Type", "text/plain")
+		req.ContentLength = 16 << 30
+		_, lines := serveLogged(t, &GinLogOption{MaxReqBodySize: limit}, setup, req)
+		if received != "abc" {
+			t.Errorf("limit %d: handler should get the whole body: %s", limit, received)
+		}
+		if limit == 2 {
+			if body := lines[0]["body"]; body != "ab...(truncated, total 17179869184 bytes)" {
+				t.Errorf("unexpected truncated body log: %v", body)
+			}
+		} else if body := lines[0]["body"]; body != "abc" {
+			t.Errorf("limit %d: unexpected body log: %v", limit, body)
+		}
+	}
+}
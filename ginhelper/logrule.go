@@ -0,0 +1,71 @@
+package ginhelper
+
+import (
+	"github.com/gin-gonic/gin"
+	"path"
+	"strings"
+)
+
+// LogRule changes what GinLogMiddleware logs for matched requests,
+// switches of all matched rules are combined
+type LogRule struct {
+	// one of
+	//   gin route pattern, matched against c.FullPath(), e.g. "/files/:id/upload"
+	//   exact request path, e.g. "/api/login"
+	//   prefix ending with "*", e.g. "/internal/*" matches "/internal" and everything under it
+	//   glob of path.Match, matched against request path, e.g. "/api/*/health"
+	Path string
+
+	SkipReqBody  bool
+	SkipRespBody bool
+	SkipHeaders  bool
+
+	// no REQUEST / RESPONSE log lines at all, e.g. health checks.
+	// logger and req id are still set into request context
+	SkipLog bool
+}
+
+// merged switches of matched rules
+type logSkip struct {
+	reqBody  bool
+	respBody bool
+	headers  bool
+	log      bool
+}
+
+func (r *LogRule) match(c *gin.Context) bool {
+	reqPath := c.Request.URL.Path
+	if r.Path == reqPath || (r.Path == c.FullPath() && r.Path != "") {
+		return true
+	}
+	if strings.HasSuffix(r.Path, "*") {
+		prefix := strings.TrimSuffix(r.Path, "*")
+		if strings.HasPrefix(reqPath, prefix) || reqPath == strings.TrimSuffix(prefix, "/") {
+			return true
+		}
+	}
+	if strings.ContainsAny(r.Path, "*?[") {
+		matched, _ := path.Match(r.Path, reqPath)
+		return matched
+	}
+	return false
+}
+
+// legacy adds paths of deprecated AddIgnoreReadReqBodyPath
+func matchLogRules(rules []*LogRule, legacy bool, c *gin.Context) *logSkip {
+	skip := &logSkip{}
+	if legacy && isIgnoreReadBodyPath(c.Request.URL.Path) {
+		skip.reqBody = true
+		skip.respBody = true
+	}
+	for _, r := range rules {
+		if !r.match(c) {
+			continue
+		}
+		skip.reqBody = skip.reqBody || r.SkipReqBody
+		skip.respBody = skip.respBody || r.SkipRespBody
+		skip.headers = skip.headers || r.SkipHeaders
+		skip.log = skip.log || r.SkipLog
+	}
+	return skip
+}
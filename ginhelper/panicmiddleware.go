@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"net/http"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -29,6 +31,9 @@ func (c *CustomErrStruct) Append(msg string) *CustomErrStruct {
 	return t
 }
 
+// ParseCustomErr splits "code|msg" error message.
+//
+// Deprecated: use AppError and AsAppError instead
 func ParseCustomErr(err error) *CustomErrStruct {
 	msg := err.Error()
 	if !strings.Contains(msg, DefaultSep) {
@@ -48,6 +53,14 @@ func ParseCustomErr(err error) *CustomErrStruct {
 	}
 }
 
+// "code|msg" is split like ParseCustomErr does, a non numeric code is DefaultCustomErrCode
+func parseLegacyErr(err error) (*CustomErrStruct, bool) {
+	if !strings.Contains(err.Error(), DefaultSep) {
+		return nil, false
+	}
+	return ParseCustomErr(err), true
+}
+
 func parseStrCode(code string) int {
 	code = strings.TrimSpace(code)
 	c, err := strconv.ParseInt(code, 10, 64)
@@ -92,6 +105,30 @@ func RecoveryMiddleware(f func(*gin.Context, error)) gin.HandlerFunc {
 }
 
 func DefaultStopExecHandler(c *gin.Context, err error) {
-	cerr := ParseCustomErr(err)
-	ReturnJson(c, 400, cerr.Code, cerr.Msg, "")
+	HandleError(c, err)
+}
+
+// HandleError returns err to client by its AppError,
+// internal causes and server errors are logged by request logger
+func HandleError(c *gin.Context, err error) {
+	appErr := AsAppError(err)
+
+	if appErr.Cause != nil || appErr.Status >= http.StatusInternalServerError {
+		logger := zerolog.Ctx(c.Request.Context())
+		event := logger.Warn()
+		if appErr.Status >= http.StatusInternalServerError {
+			event = logger.Error()
+		}
+		event = event.Err(err)
+		if appErr.Cause != nil && appErr.Cause != err {
+			event = event.AnErr("cause", appErr.Cause)
+		}
+		event.Int("statusCode", appErr.Status).Int("code", appErr.Code).Msg(appErr.Msg)
+	}
+
+	var data interface{} = ""
+	if appErr.Details != nil {
+		data = appErr.Details
+	}
+	ReturnJson(c, appErr.Status, appErr.Code, appErr.Msg, data)
 }
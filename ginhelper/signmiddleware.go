@@ -0,0 +1,168 @@
+package ginhelper
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/go-api-starter/httpclient"
+	"github.com/rs/zerolog"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// verify requests signed by httpclient.NewSignMiddleware
+
+const defaultMaxSkew = 5 * time.Minute
+
+// default max request body bytes read for verification
+const DefaultMaxSignedBodySize = 10 << 20
+
+// NonceStore remembers nonces to reject replayed requests,
+// implement it with redis when running several instances
+type NonceStore interface {
+	// Seen records nonce for ttl, returns true if it is already recorded
+	Seen(nonce string, ttl time.Duration) bool
+}
+
+type SignatureOption struct {
+	// key id -> secret, request without key id header uses Secrets[""]
+	Secrets map[string]string
+
+	// allowed difference between request timestamp and server time, default is 5 minutes
+	MaxSkew time.Duration
+
+	// default is an in-memory store
+	NonceStore NonceStore
+
+	// default is httpclient.DefaultSignHeaders
+	Headers *httpclient.SignHeaders
+
+	// same as httpclient.SignOption.SignedHeaders of the client
+	SignedHeaders []string
+
+	// larger request body is rejected with 413, 0 means DefaultMaxSignedBodySize, negative means no limit
+	MaxBodySize int64
+}
+
+func SignatureMiddleware(opt *SignatureOption) gin.HandlerFunc {
+	maxSkew := opt.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = defaultMaxSkew
+	}
+	store := opt.NonceStore
+	if store == nil {
+		store = NewMemoryNonceStore()
+	}
+	headers := opt.Headers
+	if headers == nil {
+		headers = httpclient.DefaultSignHeaders
+	}
+	maxBody := opt.MaxBodySize
+	if maxBody == 0 {
+		maxBody = DefaultMaxSignedBodySize
+	}
+
+	return func(c *gin.Context) {
+		logger := zerolog.Ctx(c.Request.Context())
+		reject := func(reason string) {
+			logger.Warn().Str("reason", reason).Msg("verify request signature failed")
+			Return401Json(c, "invalid signature")
+		}
+
+		secret, ok := opt.Secrets[c.GetHeader(headers.KeyId)]
+		if !ok {
+			reject("unknown key id")
+			return
+		}
+
+		timestamp := c.GetHeader(headers.Timestamp)
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			reject("invalid timestamp")
+			return
+		}
+		skew := time.Since(time.Unix(sec, 0))
+		if skew > maxSkew || skew < -maxSkew {
+			reject("timestamp out of allowed skew")
+			return
+		}
+
+		nonce := c.GetHeader(headers.Nonce)
+		if nonce == "" {
+			reject("missing nonce")
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			var r io.Reader = c.Request.Body
+			if maxBody > 0 {
+				r = io.LimitReader(r, maxBody+1)
+			}
+			body, err = ioutil.ReadAll(r)
+			if err != nil {
+				reject("read body failed")
+				return
+			}
+			if maxBody > 0 && int64(len(body)) > maxBody {
+				logger.Warn().Int64("maxBodySize", maxBody).Msg("signed request body too large")
+				ReturnJson(c, http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge, "request body too large", "")
+				return
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		}
+
+		expect := httpclient.Sign(secret, c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body,
+			httpclient.SignedHeaderLines(c.Request, opt.SignedHeaders)...)
+		if !hmac.Equal([]byte(expect), []byte(c.GetHeader(headers.Signature))) {
+			reject("signature mismatch")
+			return
+		}
+
+		// only record nonce of valid signature, a nonce lives as long as its timestamp is accepted
+		if store.Seen(nonce, 2*maxSkew) {
+			reject("replayed nonce")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+type memoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{
+		nonces:    make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryNonceStore) Seen(nonce string, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, expire := range s.nonces {
+			if now.After(expire) {
+				delete(s.nonces, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expire, ok := s.nonces[nonce]; ok && now.Before(expire) {
+		return true
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return false
+}
@@ -0,0 +1,136 @@
+package ginhelper
+
+import (
+	"bytes"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/leyle/go-api-starter/httpclient"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignatureMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(SignatureMiddleware(&SignatureOption{
+		Secrets: map[string]string{"partner": "s3cret"},
+	}))
+	e.POST("/callback", func(c *gin.Context) {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(200, string(body))
+	})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	// keep the last signed request to replay it
+	var signed *http.Request
+	capture := func(next http.RoundTripper) http.RoundTripper {
+		return httpclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			signed = req
+			return next.RoundTrip(req)
+		})
+	}
+
+	send := func(secret string) *httpclient.ClientResponse {
+		client := httpclient.NewClient(&httpclient.ClientOption{
+			Middlewares: []httpclient.Middleware{
+				httpclient.NewSignMiddleware(&httpclient.SignOption{KeyId: "partner", Secret: secret}),
+				capture,
+			},
+		})
+		return client.Post(&httpclient.ClientRequest{
+			Ctx:   context.Background(),
+			Url:   ts.URL + "/callback?event=paid",
+			Body:  []byte(`{"orderId":"1"}`),
+			Debug: true,
+		})
+	}
+
+	resp := send("s3cret")
+	if resp.Err != nil || resp.Code != 200 || string(resp.Body) != `{"orderId":"1"}` {
+		t.Fatalf("unexpected response: %v %d %s", resp.Err, resp.Code, resp.Body)
+	}
+
+	// replay the same signed request
+	replay, _ := http.NewRequest(http.MethodPost, signed.URL.String(), bytes.NewBufferString(`{"orderId":"1"}`))
+	replay.Header = signed.Header.Clone()
+	rr, err := http.DefaultClient.Do(replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr.Body.Close()
+	if rr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("replayed request should be rejected, got %d", rr.StatusCode)
+	}
+
+	// tampered body
+	tampered, _ := http.NewRequest(http.MethodPost, signed.URL.String(), bytes.NewBufferString(`{"orderId":"2"}`))
+	tampered.Header = signed.Header.Clone()
+	tampered.Header.Set("X-Nonce", "another-nonce")
+	rr, err = http.DefaultClient.Do(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr.Body.Close()
+	if rr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("tampered request should be rejected, got %d", rr.StatusCode)
+	}
+
+	resp = send("wrong")
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret should be rejected, got %d", resp.Code)
+	}
+}
+
+func TestSignatureSignedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	signedHeaders := []string{"Content-Type", "X-Tenant", "Host"}
+	e := gin.New()
+	e.Use(SignatureMiddleware(&SignatureOption{
+		Secrets:       map[string]string{"": "s3cret"},
+		SignedHeaders: signedHeaders,
+		MaxBodySize:   32,
+	}))
+	e.POST("/callback", func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	// changes X-Tenant after signing
+	tamper := func(next http.RoundTripper) http.RoundTripper {
+		return httpclient.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Tenant", "other")
+			return next.RoundTrip(req)
+		})
+	}
+	send := func(signed []string, body string, extra ...httpclient.Middleware) int {
+		client := httpclient.NewClient(&httpclient.ClientOption{
+			Middlewares: append([]httpclient.Middleware{
+				httpclient.NewSignMiddleware(&httpclient.SignOption{Secret: "s3cret", SignedHeaders: signed}),
+			}, extra...),
+		})
+		return client.Post(&httpclient.ClientRequest{
+			Ctx:     context.Background(),
+			Url:     ts.URL + "/callback",
+			Headers: map[string]string{"Content-Type": "application/json", "X-Tenant": "acme"},
+			Body:    []byte(body),
+		}).Code
+	}
+
+	if code := send(signedHeaders, `{"orderId":"1"}`); code != 200 {
+		t.Errorf("signed headers should be verified, got %d", code)
+	}
+	if code := send(signedHeaders, `{"orderId":"1"}`, tamper); code != http.StatusUnauthorized {
+		t.Errorf("tampered signed header should be rejected, got %d", code)
+	}
+	if code := send(nil, `{"orderId":"1"}`); code != http.StatusUnauthorized {
+		t.Errorf("request without signed headers should be rejected, got %d", code)
+	}
+	if code := send(signedHeaders, `{"orderId":"`+strings.Repeat("1", 32)+`"}`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body should be rejected, got %d", code)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/leyle/go-api-starter
 go 1.15
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/aws/aws-sdk-go v1.34.28 // indirect
 	github.com/gin-gonic/gin v1.7.4
 	github.com/google/uuid v1.1.2
@@ -11,4 +12,5 @@ require (
 	github.com/xdg/scram v0.0.0-20180814205039-7eeb5667e42c // indirect
 	github.com/xdg/stringprep v0.0.0-20180714160509-73f8eece6fdc // indirect
 	go.mongodb.org/mongo-driver v1.7.2
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -3,11 +3,14 @@ package httpclient
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"github.com/leyle/go-api-starter/logmiddleware"
 	"github.com/rs/zerolog"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -24,75 +27,150 @@ type ClientRequest struct {
 	Body    []byte
 	Timeout int
 
-	V interface{} // response body unmarshal struct
+	// multi-value headers, a key set in both HttpHeader and Headers uses values of HttpHeader
+	HttpHeader http.Header
+
+	// applied after ClientOption.Middlewares, only for this request
+	Middlewares []Middleware
+
+	// streaming request body, only used when Body is nil
+	// BodyLength is the size of BodyReader, 0 means unknown and body is sent chunked
+	BodyReader io.Reader
+	BodyLength int64
+
+	// response body is decoded by its Content-Type, see RegisterCodec.
+	// V is for 2xx (or ExpectStatus if it is set) responses, ErrV is for the others.
+	// if ErrV is nil, other responses are decoded into V as before,
+	// unless ExpectStatus or FailOnNon2xx is set, then they are only kept in StatusError.
+	// empty bodies are not decoded, V and ErrV are left untouched.
+	// Strict rejects unknown fields, only JSON and YAML support it
+	V      interface{}
+	ErrV   interface{}
+	Strict bool
+
+	// if set, response status code not in ExpectStatus returns *StatusError in ClientResponse.Err,
+	// FailOnNon2xx does the same for any non 2xx status code, ExpectStatus takes precedence.
+	// Stream is not called when status is unexpected
+	ExpectStatus []int
+	FailOnNon2xx bool
+
+	// if set, response body is not read into ClientResponse.Body,
+	// it is handed to Stream and closed after Stream returns.
+	// default timeout is not applied, only Timeout if it is set
+	Stream StreamFunc
+
+	// overrides ClientOption.MaxResponseSize, negative means no limit
+	MaxResponseSize int64
+
+	Debug bool // if true, logmiddleware response body
+
+	// if true, an equivalent curl command is logged by LogMiddleware, secrets are redacted
+	Curl bool
 
-	Debug  bool // if true, logmiddleware response body
 	method string
 }
 
+// StreamFunc consumes the open response body, resp.Code and resp.Raw are already set
+type StreamFunc func(resp *ClientResponse, body io.Reader) error
+
 type ClientResponse struct {
 	Code   int   // http status code and default err code(0)
 	Err    error // when program err occurred
 	Body   []byte
 	Raw    *http.Response // be careful, response.Body can be read exactly once
 	Logger *zerolog.Logger
+
+	// response headers and cookies set by Set-Cookie
+	Header  http.Header
+	Cookies []*http.Cookie
+
+	// phase breakdown of the request
+	Timing *Timing
 }
 
+// package level wrappers use DefaultClient
 func Get(req *ClientRequest) *ClientResponse {
-	req.method = http.MethodGet
-	resp := httpRequest(req)
-	return resp
+	return DefaultClient.Get(req)
 }
 
 func Post(req *ClientRequest) *ClientResponse {
-	req.method = http.MethodPost
-	resp := httpRequest(req)
-	return resp
+	return DefaultClient.Post(req)
 }
 
 func Put(req *ClientRequest) *ClientResponse {
-	req.method = http.MethodPut
-	resp := httpRequest(req)
-	return resp
+	return DefaultClient.Put(req)
 }
 
 func Delete(req *ClientRequest) *ClientResponse {
-	req.method = http.MethodDelete
-	resp := httpRequest(req)
-	return resp
+	return DefaultClient.Delete(req)
 }
 
 func API(req *ClientRequest, method string) *ClientResponse {
-	req.method = method
-	resp := httpRequest(req)
-	return resp
+	return DefaultClient.API(req, method)
 }
 
-func httpRequest(req *ClientRequest) *ClientResponse {
+func Download(req *ClientRequest, path string) *ClientResponse {
+	return DefaultClient.Download(req, path)
+}
+
+func SSE(req *ClientRequest) *EventStream {
+	return DefaultClient.SSE(req)
+}
+
+func NDJSON(req *ClientRequest, method string) *NDJSONStream {
+	return DefaultClient.NDJSON(req, method)
+}
+
+func (c *Client) httpRequest(req *ClientRequest) *ClientResponse {
 	var err error
-	startT := time.Now()
 	resp := &ClientResponse{
 		Code: HttpClientErrCode,
 		Err:  err,
 	}
 
-	lctx := zerolog.Ctx(req.Ctx)
-	logger := lctx.With().Str("method", req.method).Str("url", req.Url).Logger()
+	ctx := req.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	lctx := zerolog.Ctx(ctx).With().Str("method", req.method).Str("url", redactURL(req.Url))
+	if c.opt.Name != "" {
+		lctx = lctx.Str("client", c.opt.Name)
+	}
+	logger := lctx.Logger()
 	resp.Logger = &logger
-	logger.Debug().Msg("start http request...")
+
+	// middlewares get logger and request options from request context
+	ctx = logger.WithContext(ctx)
+	ctx = context.WithValue(ctx, reqInfoKey, &reqInfo{
+		Debug:  req.Debug,
+		Stream: req.Stream != nil,
+		Curl:   req.Curl,
+
+		MaxResponseSize: c.maxResponseSize(req),
+	})
+
+	tracer := newTracer()
+	ctx = httptrace.WithClientTrace(ctx, tracer.clientTrace())
+	defer c.finish(req, resp, tracer)
 
 	// generate req
-	var newReq *http.Request
+	var body io.Reader
 	if req.Body != nil {
-		newReq, err = http.NewRequest(req.method, req.Url, bytes.NewBuffer(req.Body))
-	} else {
-		newReq, err = http.NewRequest(req.method, req.Url, nil)
+		body = bytes.NewBuffer(req.Body)
+	} else if req.BodyReader != nil {
+		body = req.BodyReader
 	}
+	newReq, err := http.NewRequestWithContext(ctx, req.method, req.Url, body)
 	if err != nil {
+		err = redactErr(err)
 		logger.Error().Err(err).Send()
 		resp.Err = err
 		return resp
 	}
+	if req.Body == nil && req.BodyLength > 0 {
+		newReq.ContentLength = req.BodyLength
+	}
 
 	// process url query string
 	if req.Query != nil {
@@ -107,34 +185,75 @@ func httpRequest(req *ClientRequest) *ClientResponse {
 			}
 		}
 		newReq.URL.RawQuery = urlV.Encode()
-		logger.Debug().Str("fullUrl", newReq.URL.String()).Send()
 	}
 
 	// process headers
 	for k, v := range req.Headers {
 		newReq.Header.Add(k, v)
 	}
+	for k, vs := range req.HttpHeader {
+		newReq.Header.Del(k)
+		for _, v := range vs {
+			newReq.Header.Add(k, v)
+		}
+	}
+
+	// compress large body
+	if min := c.opt.GzipRequestMinSize; min > 0 && len(req.Body) >= min && newReq.Header.Get("Content-Encoding") == "" {
+		data, err := gzipBody(req.Body)
+		if err != nil {
+			logger.Error().Err(err).Send()
+			resp.Err = err
+			return resp
+		}
+		newReq.Body = ioutil.NopCloser(bytes.NewReader(data))
+		newReq.ContentLength = int64(len(data))
+		newReq.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+		newReq.Header.Set("Content-Encoding", "gzip")
+	}
 
 	// timeout
 	timeout := reqTimeout
 	if req.Timeout > 0 {
 		timeout = time.Duration(req.Timeout)
+	} else if req.Stream != nil {
+		timeout = 0
 	}
 	client := &http.Client{
-		Timeout: timeout * time.Second,
+		Transport: c.transport(req),
+		Jar:       c.opt.Jar,
+		Timeout:   timeout * time.Second,
 	}
 
 	doResp, err := client.Do(newReq)
 	if err != nil {
+		err = redactErr(err)
 		logger.Error().Err(err).Send()
 		resp.Err = err
 		return resp
 	}
+	defer doResp.Body.Close()
+	tracer.responseGot()
 	resp.Raw = doResp
 	resp.Code = doResp.StatusCode
+	resp.Header = doResp.Header
+	resp.Cookies = doResp.Cookies()
 
-	// print debug info
-	logger.Debug().Int("statusCode", doResp.StatusCode).Str("elapsed", time.Since(startT).String()).Msg("http response")
+	if req.Stream != nil {
+		if !req.checkStatus(resp.Code) {
+			resp.Err = readStatusError(doResp, doResp.Body)
+			logger.Error().Err(resp.Err).Send()
+			return resp
+		}
+		err = req.Stream(resp, doResp.Body)
+		if err != nil {
+			logger.Error().Err(err).Send()
+			resp.Err = err
+		}
+		return resp
+	}
 
 	respBody, err := ioutil.ReadAll(doResp.Body)
 	if err != nil {
@@ -142,23 +261,56 @@ func httpRequest(req *ClientRequest) *ClientResponse {
 		resp.Err = err
 		return resp
 	}
-	defer doResp.Body.Close()
 	resp.Body = respBody
 
-	if req.Debug {
-		// print response body
-		logger.Debug().Str("responseBody", string(respBody)).Send()
+	// decode response body by its Content-Type, V for success response, ErrV for the others
+	target := req.V
+	if !req.isSuccess(resp.Code) {
+		target = req.ErrV
+		if target == nil && len(req.ExpectStatus) == 0 && !req.FailOnNon2xx {
+			// compatible with callers reading error payloads from V
+			target = req.V
+		}
 	}
-
-	// check if need unmarshal response body
-	if req.V != nil {
-		err = json.Unmarshal(respBody, &req.V)
+	if target != nil && len(respBody) > 0 {
+		err = Decode(doResp.Header.Get("Content-Type"), respBody, target, req.Strict)
 		if err != nil {
 			logger.Error().Err(err).Send()
 			resp.Err = err
-			return resp
 		}
 	}
 
+	if !req.checkStatus(resp.Code) {
+		resp.Err = newStatusError(doResp, respBody)
+		logger.Error().Err(resp.Err).Send()
+	}
+
 	return resp
 }
+
+// finish sets timing of resp and records metrics
+func (c *Client) finish(req *ClientRequest, resp *ClientResponse, tracer *tracer) {
+	resp.Timing = tracer.timing()
+	if req.Debug {
+		t := resp.Timing
+		resp.Logger.Debug().Int("statusCode", resp.Code).
+			Str("dns", t.DNS.String()).Str("connect", t.Connect.String()).Str("tls", t.TLS.String()).
+			Str("ttfb", t.TTFB.String()).Str("bodyRead", t.BodyRead.String()).Str("total", t.Total.String()).
+			Bool("reused", t.Reused).Msg("http timing")
+	}
+	if c.opt.Metrics != nil {
+		c.opt.Metrics.Observe(c.opt.Name, req.method, req.Url, resp.Code, resp.Timing)
+	}
+}
+
+func redactURL(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		// query can not be parsed, mask all of it
+		if i := strings.Index(rawUrl, "?"); i >= 0 {
+			return rawUrl[:i+1] + logmiddleware.DefaultMask
+		}
+		return rawUrl
+	}
+	return logmiddleware.DefaultRedactor.URL(u)
+}
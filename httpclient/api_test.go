@@ -4,15 +4,42 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/leyle/go-api-starter/logmiddleware"
+	"os"
 	"testing"
 )
 
 // https://httpbin.org/get
 // https://httpbin.org/post
 // docker run -p 8000:80 kennethreitz/httpbin
+// tests replay testdata/httpbin.yaml, set HTTPCLIENT_RECORD=1 to record it again from the real host,
+// HTTPBIN_URL changes the host, default is the docker one
+
+func httpbinUrl(path string) string {
+	host := os.Getenv("HTTPBIN_URL")
+	if host == "" {
+		host = "http://localhost:8000"
+	}
+	return host + path
+}
+
+func newTestClient(t *testing.T, cassettePath string) *Client {
+	mode := CassetteReplay
+	if os.Getenv("HTTPCLIENT_RECORD") == "1" {
+		mode = CassetteRecord
+	}
+	cassette, err := NewCassette(cassettePath, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(&ClientOption{
+		Transport:   cassette,
+		Middlewares: []Middleware{LogMiddleware},
+	})
+}
 
 func TestGet(t *testing.T) {
-	url := "http://192.168.2.40:8000/get"
+	client := newTestClient(t, "testdata/httpbin.yaml")
+	url := httpbinUrl("/get")
 	logger := logmiddleware.GetLogger(logmiddleware.LogTargetStdout)
 	ctx := context.Background()
 	lctx := logger.WithContext(ctx)
@@ -21,24 +48,35 @@ func TestGet(t *testing.T) {
 	query["name"] = []string{"jack", "telsa"}
 	query["age"] = []string{"12", "23"}
 
+	type RespForm struct {
+		Args map[string][]string `json:"args"`
+	}
+	var respForm *RespForm
+
 	req := &ClientRequest{
 		Ctx:   lctx,
 		Url:   url,
 		Query: query,
 		Debug: true,
+		V:     &respForm,
 	}
 
-	resp := Get(req)
+	resp := client.Get(req)
 	if resp.Err != nil {
 		t.Fatal(resp.Err)
 	}
 
 	t.Log(resp.Code)
 	t.Log(string(resp.Body))
+
+	if len(respForm.Args["name"]) != 2 || respForm.Args["name"][1] != "telsa" {
+		t.Errorf("unexpected args: %v", respForm.Args)
+	}
 }
 
 func TestPost(t *testing.T) {
-	url := "http://192.168.2.40:8000/post"
+	client := newTestClient(t, "testdata/httpbin.yaml")
+	url := httpbinUrl("/post")
 	logger := logmiddleware.GetLogger(logmiddleware.LogTargetStdout)
 	ctx := context.Background()
 	lctx := logger.WithContext(ctx)
@@ -77,7 +115,7 @@ func TestPost(t *testing.T) {
 		V:     &respForm,
 	}
 
-	resp := Post(req)
+	resp := client.Post(req)
 	if resp.Err != nil {
 		t.Fatal(resp.Err)
 	}
@@ -87,4 +125,45 @@ func TestPost(t *testing.T) {
 
 	t.Log("xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx")
 	t.Log(respForm.Json.Name, respForm.Json.Passwd)
+	if respForm.Json.Name != form.Name {
+		t.Errorf("unexpected name: %s", respForm.Json.Name)
+	}
+}
+
+func TestMockTransport(t *testing.T) {
+	mock := NewMockTransport().
+		On("GET", "/users/1", 200, `{"id":"1"}`).
+		On("", "/users/2", 404, `{"error":"not_found"}`)
+	client := NewClient(&ClientOption{Transport: mock})
+
+	var user map[string]string
+	resp := client.Get(&ClientRequest{
+		Ctx: context.Background(),
+		Url: "http://partner.local/users/1",
+		V:   &user,
+	})
+	if resp.Err != nil || user["id"] != "1" {
+		t.Fatalf("unexpected response: %v %v", resp.Err, user)
+	}
+
+	resp = client.Delete(&ClientRequest{
+		Ctx:          context.Background(),
+		Url:          "http://partner.local/users/2",
+		FailOnNon2xx: true,
+	})
+	if !IsStatusCode(resp.Err, 404) {
+		t.Errorf("expect 404, got %v", resp.Err)
+	}
+
+	resp = client.Get(&ClientRequest{
+		Ctx: context.Background(),
+		Url: "http://partner.local/unknown",
+	})
+	if resp.Err == nil {
+		t.Error("expect error of unmatched route")
+	}
+
+	if mock.CallCount("GET", "/users/1") != 1 || mock.CallCount("DELETE", "/users/2") != 1 || len(mock.Calls()) != 3 {
+		t.Errorf("unexpected calls: %v", mock.Calls())
+	}
 }
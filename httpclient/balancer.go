@@ -0,0 +1,258 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// client side load balancing over several base urls.
+// scheme and host of request url are replaced by the selected target, path is appended to target path,
+// so requests can use a logical host, e.g. http://couchdb/dev/_find
+//   lb, err := NewBalancer(&BalancerOption{Targets: []string{"http://node1:5984", "http://node2:5984"}})
+//   client := NewClient(&ClientOption{Middlewares: []Middleware{LogMiddleware, lb.Middleware}})
+
+type BalancePolicy int
+
+const (
+	RoundRobin BalancePolicy = iota
+	LeastOutstanding
+)
+
+const (
+	defaultMaxFails      = 3
+	defaultEjectDuration = 30 * time.Second
+)
+
+type BalancerOption struct {
+	// base urls, e.g. http://node1:5984
+	Targets []string
+	Policy  BalancePolicy
+
+	// consecutive failures (transport error or 5xx) before a target is ejected, default is 3
+	MaxFails int
+
+	// ejected target is selected again after EjectDuration, default is 30s
+	EjectDuration time.Duration
+
+	// if > 0, GET and HEAD requests without body send a second request to another target
+	// when the first one has not answered after HedgeDelay, the first response wins
+	HedgeDelay time.Duration
+}
+
+type Balancer struct {
+	opt     *BalancerOption
+	targets []*target
+	next    uint32
+}
+
+type target struct {
+	base        *url.URL
+	outstanding int64
+
+	mu           sync.Mutex
+	fails        int
+	ejectedUntil time.Time
+}
+
+func NewBalancer(opt *BalancerOption) (*Balancer, error) {
+	if len(opt.Targets) == 0 {
+		return nil, errors.New("balancer: no target")
+	}
+	if opt.MaxFails <= 0 {
+		opt.MaxFails = defaultMaxFails
+	}
+	if opt.EjectDuration <= 0 {
+		opt.EjectDuration = defaultEjectDuration
+	}
+
+	b := &Balancer{opt: opt}
+	for _, t := range opt.Targets {
+		u, err := url.Parse(t)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("balancer: invalid target[%s], should be like http://host:port", t)
+		}
+		b.targets = append(b.targets, &target{base: u})
+	}
+	return b, nil
+}
+
+func (t *target) available(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !now.Before(t.ejectedUntil)
+}
+
+func (t *target) report(failed bool, maxFails int, ejectDuration time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !failed {
+		t.fails = 0
+		return false
+	}
+	t.fails++
+	if t.fails >= maxFails {
+		t.fails = 0
+		t.ejectedUntil = time.Now().Add(ejectDuration)
+		return true
+	}
+	return false
+}
+
+// pick selects a target except the excluded one,
+// if all targets are ejected, they are all candidates
+func (b *Balancer) pick(exclude *target) *target {
+	now := time.Now()
+	candidates := make([]*target, 0, len(b.targets))
+	for _, t := range b.targets {
+		if t != exclude && t.available(now) {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, t := range b.targets {
+			if t != exclude {
+				candidates = append(candidates, t)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// scan starts at a rotating index, so ties are broken round-robin
+	n := atomic.AddUint32(&b.next, 1)
+	start := int(n-1) % len(candidates)
+	if b.opt.Policy == LeastOutstanding {
+		best := candidates[start]
+		for i := 1; i < len(candidates); i++ {
+			t := candidates[(start+i)%len(candidates)]
+			if atomic.LoadInt64(&t.outstanding) < atomic.LoadInt64(&best.outstanding) {
+				best = t
+			}
+		}
+		return best
+	}
+	return candidates[start]
+}
+
+func (b *Balancer) Middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		first := b.pick(nil)
+		hedge := b.opt.HedgeDelay > 0 && len(b.targets) > 1 &&
+			(req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+			(req.Body == nil || req.Body == http.NoBody)
+		if !hedge {
+			return b.send(next, req, first)
+		}
+		return b.hedged(next, req, first)
+	})
+}
+
+func (b *Balancer) send(next http.RoundTripper, req *http.Request, t *target) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = t.base.Scheme
+	r.URL.Host = t.base.Host
+	r.URL.Path = strings.TrimSuffix(t.base.Path, "/") + req.URL.Path
+	if req.URL.RawPath != "" {
+		r.URL.RawPath = strings.TrimSuffix(t.base.EscapedPath(), "/") + req.URL.RawPath
+	}
+	r.Host = ""
+
+	atomic.AddInt64(&t.outstanding, 1)
+	resp, err := next.RoundTrip(r)
+	atomic.AddInt64(&t.outstanding, -1)
+
+	// a canceled request says nothing about the target health
+	if req.Context().Err() == nil {
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		if t.report(failed, b.opt.MaxFails, b.opt.EjectDuration) {
+			zerolog.Ctx(req.Context()).Warn().Str("target", t.base.String()).Msg("balancer target ejected")
+		}
+	}
+	return resp, err
+}
+
+type hedgeResult struct {
+	resp *http.Response
+	err  error
+	idx  int
+}
+
+func (b *Balancer) hedged(next http.RoundTripper, req *http.Request, first *target) (*http.Response, error) {
+	results := make(chan *hedgeResult, 2)
+	var cancels []context.CancelFunc
+	attempt := func(t *target) {
+		ctx, cancel := context.WithCancel(req.Context())
+		idx := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := b.send(next, req.WithContext(ctx), t)
+			results <- &hedgeResult{resp: resp, err: err, idx: idx}
+		}()
+	}
+
+	attempt(first)
+	timer := time.NewTimer(b.opt.HedgeDelay)
+	defer timer.Stop()
+
+	var res *hedgeResult
+	received := 0
+	select {
+	case res = <-results:
+		received++
+	case <-timer.C:
+		if second := b.pick(first); second != nil {
+			zerolog.Ctx(req.Context()).Debug().Str("target", second.base.String()).Msg("send hedged request")
+			attempt(second)
+		}
+		res = <-results
+		received++
+		// the other one is still a candidate if the first answer is an error
+		if res.err != nil && received < len(cancels) {
+			res = <-results
+			received++
+		}
+	}
+
+	// cancel the loser and release its response
+	for i, cancel := range cancels {
+		if i != res.idx {
+			cancel()
+		}
+	}
+	if received < len(cancels) {
+		go func() {
+			if loser := <-results; loser.resp != nil {
+				loser.resp.Body.Close()
+			}
+		}()
+	}
+
+	if res.err != nil {
+		cancels[res.idx]()
+		return nil, res.err
+	}
+	res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: cancels[res.idx]}
+	return res.resp, nil
+}
+
+// releases context of the winning hedged request after its body is consumed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,119 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBalancer(t *testing.T) {
+	var hits [3]int32
+	var servers []*httptest.Server
+	for i := range hits {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[i], 1)
+			// the last node is broken
+			if i == 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintf(w, "node%d %s", i, r.URL.Path)
+		}))
+		defer ts.Close()
+		servers = append(servers, ts)
+	}
+
+	lb, err := NewBalancer(&BalancerOption{
+		Targets:  []string{servers[0].URL, servers[1].URL, servers[2].URL + "/prefix"},
+		MaxFails: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(&ClientOption{Middlewares: []Middleware{lb.Middleware}})
+
+	for i := 0; i < 12; i++ {
+		client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://logical/db/doc"})
+	}
+	if hits[2] != 2 {
+		t.Errorf("broken node should be ejected after 2 failures, got %d hits", hits[2])
+	}
+	if hits[0]+hits[1] != 10 || hits[0] < 4 || hits[1] < 4 {
+		t.Errorf("requests should be spread over healthy nodes: %v", hits)
+	}
+
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://logical/db/doc"})
+	if resp.Err != nil || resp.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %v %d", resp.Err, resp.Code)
+	}
+
+	if _, err := NewBalancer(&BalancerOption{Targets: []string{"node1:5984"}}); err == nil {
+		t.Error("target without scheme should be rejected")
+	}
+}
+
+func TestBalancerLeastOutstanding(t *testing.T) {
+	var hits [3]int32
+	var targets []string
+	for i := range hits {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[i], 1)
+		}))
+		defer ts.Close()
+		targets = append(targets, ts.URL)
+	}
+
+	lb, err := NewBalancer(&BalancerOption{Targets: targets, Policy: LeastOutstanding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(&ClientOption{Middlewares: []Middleware{lb.Middleware}})
+
+	// sequential requests always tie on 0 outstanding
+	for i := 0; i < 9; i++ {
+		client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://logical/db/doc"})
+	}
+	if hits != [3]int32{3, 3, 3} {
+		t.Errorf("ties should be spread over nodes: %v", hits)
+	}
+}
+
+func TestBalancerHedge(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	lb, err := NewBalancer(&BalancerOption{
+		Targets:    []string{slow.URL, fast.URL},
+		HedgeDelay: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(&ClientOption{Middlewares: []Middleware{lb.Middleware}})
+
+	// round robin starts from the slow node
+	start := time.Now()
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://logical/"})
+	if resp.Err != nil || string(resp.Body) != "fast" {
+		t.Fatalf("expect hedged response: %v %s", resp.Err, resp.Body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hedged request took %s", elapsed)
+	}
+}
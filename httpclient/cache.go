@@ -0,0 +1,313 @@
+package httpclient
+
+import (
+	"bytes"
+	"container/list"
+	"github.com/rs/zerolog"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shared HTTP cache of GET responses, honors Cache-Control, Expires,
+// and revalidates stale responses by ETag / Last-Modified.
+// requests with credentials, "private" responses and responses with Set-Cookie are never cached,
+// so responses of one user are not served to another
+//   cache := NewHTTPCache(NewLRUCache(1000))
+//   client := NewClient(&ClientOption{Middlewares: []Middleware{LogMiddleware, cache.Middleware}})
+
+// response header set on responses served from cache, value is HIT or REVALIDATED
+const CacheStatusHeader = "X-Cache-Status"
+
+type CachedResponse struct {
+	Code     int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+
+	// zero means it must be revalidated before use
+	Expires time.Time
+
+	// request header values of response Vary headers
+	VaryValues map[string]string
+}
+
+// CacheStorage stores responses by key, implement it to use redis or memcached
+type CacheStorage interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse)
+	Delete(key string)
+}
+
+type HTTPCache struct {
+	storage CacheStorage
+}
+
+func NewHTTPCache(storage CacheStorage) *HTTPCache {
+	return &HTTPCache{
+		storage: storage,
+	}
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+func (h *HTTPCache) Middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		reqCC := parseCacheControl(req.Header.Get("Cache-Control"))
+		if req.Method != http.MethodGet || getReqInfo(req.Context()).Stream || hasCredentials(req) {
+			return next.RoundTrip(req)
+		}
+		if _, ok := reqCC["no-store"]; ok {
+			return next.RoundTrip(req)
+		}
+
+		logger := zerolog.Ctx(req.Context())
+		key := cacheKey(req)
+		cached, ok := h.storage.Get(key)
+		if ok && !cached.varyMatch(req) {
+			ok = false
+		}
+
+		if ok {
+			_, noCache := reqCC["no-cache"]
+			if !noCache && !cached.Expires.IsZero() && time.Now().Before(cached.Expires) {
+				logger.Debug().Msg("http cache hit")
+				return cached.toResponse(req, "HIT"), nil
+			}
+
+			// stale, revalidate if possible
+			etag := cached.Header.Get("ETag")
+			lastModified := cached.Header.Get("Last-Modified")
+			if etag != "" || lastModified != "" {
+				r := req.Clone(req.Context())
+				if etag != "" && r.Header.Get("If-None-Match") == "" {
+					r.Header.Set("If-None-Match", etag)
+				}
+				if lastModified != "" && r.Header.Get("If-Modified-Since") == "" {
+					r.Header.Set("If-Modified-Since", lastModified)
+				}
+				req = r
+			}
+		}
+
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+
+		if ok && resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			// stored response may be in use by other requests, update a copy
+			updated := *cached
+			updated.Header = cached.Header.Clone()
+			for k, vs := range resp.Header {
+				if k != "Set-Cookie" {
+					updated.Header[k] = vs
+				}
+			}
+			updated.StoredAt = time.Now()
+			updated.Expires = freshUntil(updated.Header, updated.StoredAt)
+			h.storage.Set(key, &updated)
+			logger.Debug().Msg("http cache revalidated")
+			ret := updated.toResponse(req, "REVALIDATED")
+			// cookies belong to this caller only
+			if cookies := resp.Header.Values("Set-Cookie"); len(cookies) > 0 {
+				ret.Header["Set-Cookie"] = cookies
+			}
+			return ret, nil
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+
+		respCC := parseCacheControl(resp.Header.Get("Cache-Control"))
+		_, noStore := respCC["no-store"]
+		_, private := respCC["private"]
+		// a response setting cookies is a session of one user
+		if noStore || private || len(resp.Header.Values("Set-Cookie")) > 0 {
+			h.storage.Delete(key)
+			return resp, nil
+		}
+
+		now := time.Now()
+		expires := freshUntil(resp.Header, now)
+		if expires.IsZero() && resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+			// neither fresh nor revalidatable
+			return resp, nil
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		h.storage.Set(key, &CachedResponse{
+			Code:       resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       body,
+			StoredAt:   now,
+			Expires:    expires,
+			VaryValues: varyValues(resp.Header, req),
+		})
+		return resp, nil
+	})
+}
+
+func hasCredentials(req *http.Request) bool {
+	for _, name := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// freshUntil returns expire time from max-age or Expires, zero if response must be revalidated
+func freshUntil(header http.Header, now time.Time) time.Time {
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := cc["no-cache"]; ok {
+		return time.Time{}
+	}
+	if v, ok := cc["max-age"]; ok {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec <= 0 {
+			return time.Time{}
+		}
+		age, _ := strconv.Atoi(header.Get("Age"))
+		return now.Add(time.Duration(sec-age) * time.Second)
+	}
+	if v := header.Get("Expires"); v != "" {
+		t, err := http.ParseTime(v)
+		if err != nil || !t.After(now) {
+			return time.Time{}
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func parseCacheControl(v string) map[string]string {
+	cc := make(map[string]string)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) == 2 {
+			cc[key] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		} else {
+			cc[key] = ""
+		}
+	}
+	return cc
+}
+
+func varyValues(header http.Header, req *http.Request) map[string]string {
+	vary := header.Values("Vary")
+	if len(vary) == 0 {
+		return nil
+	}
+	values := make(map[string]string)
+	for _, v := range vary {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" {
+				values[name] = req.Header.Get(name)
+			}
+		}
+	}
+	return values
+}
+
+func (c *CachedResponse) varyMatch(req *http.Request) bool {
+	for name, v := range c.VaryValues {
+		if name == "*" || req.Header.Get(name) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CachedResponse) toResponse(req *http.Request, status string) *http.Response {
+	header := c.Header.Clone()
+	header.Set(CacheStatusHeader, status)
+	header.Set("Age", strconv.Itoa(int(time.Since(c.StoredAt).Seconds())))
+	return &http.Response{
+		Status:        strconv.Itoa(c.Code) + " " + http.StatusText(c.Code),
+		StatusCode:    c.Code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// in-memory LRU storage
+type lruCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type lruEntry struct {
+	key  string
+	resp *CachedResponse
+}
+
+// NewLRUCache keeps at most maxEntries responses, least recently used ones are evicted
+func NewLRUCache(maxEntries int) CacheStorage {
+	return &lruCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (l *lruCache) Get(key string) (*CachedResponse, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		l.ll.MoveToFront(e)
+		return e.Value.(*lruEntry).resp, true
+	}
+	return nil, false
+}
+
+func (l *lruCache) Set(key string, resp *CachedResponse) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		l.ll.MoveToFront(e)
+		e.Value.(*lruEntry).resp = resp
+		return
+	}
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, resp: resp})
+	if l.maxEntries > 0 && l.ll.Len() > l.maxEntries {
+		oldest := l.ll.Back()
+		l.ll.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *lruCache) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		l.ll.Remove(e)
+		delete(l.items, key)
+	}
+}
@@ -0,0 +1,146 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPCache(t *testing.T) {
+	var hits, notModified int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte("fresh"))
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write([]byte("etag"))
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte("nostore"))
+		}
+	}))
+	defer ts.Close()
+
+	cache := NewHTTPCache(NewLRUCache(10))
+	client := NewClient(&ClientOption{Middlewares: []Middleware{cache.Middleware}})
+	get := func(path string) *ClientResponse {
+		resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL + path})
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+		return resp
+	}
+
+	get("/fresh")
+	resp := get("/fresh")
+	if string(resp.Body) != "fresh" || resp.Header.Get(CacheStatusHeader) != "HIT" || hits != 1 {
+		t.Errorf("expect cache hit: %s %v, hits %d", resp.Body, resp.Header, hits)
+	}
+
+	get("/etag")
+	resp = get("/etag")
+	if string(resp.Body) != "etag" || resp.Code != http.StatusOK || resp.Header.Get(CacheStatusHeader) != "REVALIDATED" || notModified != 1 {
+		t.Errorf("expect revalidated: %d %s %v, 304 %d", resp.Code, resp.Body, resp.Header, notModified)
+	}
+
+	hits = 0
+	get("/nostore")
+	get("/nostore")
+	if hits != 2 {
+		t.Errorf("no-store response should not be cached, hits %d", hits)
+	}
+}
+
+func TestHTTPCacheCredentials(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		w.Write([]byte("user:" + r.Header.Get("Authorization") + r.Header.Get("Cookie")))
+	}))
+	defer ts.Close()
+
+	cache := NewHTTPCache(NewLRUCache(10))
+	client := NewClient(&ClientOption{Middlewares: []Middleware{cache.Middleware}})
+	get := func(path string, headers map[string]string) string {
+		resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL + path, Headers: headers})
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+		return string(resp.Body)
+	}
+
+	if body := get("/me", map[string]string{"Authorization": "Bearer alice"}); body != "user:Bearer alice" {
+		t.Errorf("unexpected body %s", body)
+	}
+	if body := get("/me", map[string]string{"Cookie": "sid=bob"}); body != "user:sid=bob" {
+		t.Errorf("response of another user is served: %s", body)
+	}
+	if body := get("/me", nil); body != "user:" {
+		t.Errorf("response with credentials is served to anonymous request: %s", body)
+	}
+
+	hits = 0
+	get("/private", nil)
+	get("/private", nil)
+	if hits != 2 {
+		t.Errorf("private response should not be cached, hits %d", hits)
+	}
+}
+
+func TestHTTPCacheSetCookie(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Set-Cookie", fmt.Sprintf("sid=user%d", n))
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	cache := NewHTTPCache(NewLRUCache(10))
+	client := NewClient(&ClientOption{Middlewares: []Middleware{cache.Middleware}})
+	for i := 1; i <= 2; i++ {
+		resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL + "/login"})
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+		if cookie := resp.Header.Get("Set-Cookie"); cookie != fmt.Sprintf("sid=user%d", i) {
+			t.Errorf("request %d got cookie of another user: %s", i, cookie)
+		}
+	}
+	if hits != 2 {
+		t.Errorf("response with Set-Cookie should not be cached, hits %d", hits)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	lru := NewLRUCache(2)
+	lru.Set("a", &CachedResponse{Body: []byte("a")})
+	lru.Set("b", &CachedResponse{Body: []byte("b")})
+	lru.Get("a")
+	lru.Set("c", &CachedResponse{Body: []byte("c")})
+
+	if _, ok := lru.Get("b"); ok {
+		t.Error("least recently used entry should be evicted")
+	}
+	if _, ok := lru.Get("a"); !ok {
+		t.Error("recently used entry should be kept")
+	}
+}
@@ -0,0 +1,324 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// record/replay transport, use it as ClientOption.Transport in tests:
+//   cassette, err := NewCassette("testdata/partner.yaml", CassetteReplay)
+//   client := NewClient(&ClientOption{Transport: cassette})
+// run once with CassetteRecord against the real host to create the file,
+// then commit it and replay offline
+
+type CassetteMode int
+
+const (
+	// only replay, request without matched interaction returns ErrNoInteraction
+	CassetteReplay CassetteMode = iota
+	// always send request to the real host and record it, replacing the matched one in file
+	CassetteRecord
+	// replay if matched, otherwise send to the real host and record it
+	CassetteReplayOrRecord
+)
+
+var ErrNoInteraction = errors.New("cassette: no matched interaction")
+
+type CassetteRequest struct {
+	Method  string              `json:"method" yaml:"method"`
+	Url     string              `json:"url" yaml:"url"`
+	Headers map[string][]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    string              `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	Code    int                 `json:"code" yaml:"code"`
+	Headers map[string][]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    string              `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+type Interaction struct {
+	Request  *CassetteRequest  `json:"request" yaml:"request"`
+	Response *CassetteResponse `json:"response" yaml:"response"`
+}
+
+// Matcher reports whether outbound request matches a recorded request,
+// body is the outbound request body
+type Matcher func(req *http.Request, body []byte, recorded *CassetteRequest) bool
+
+func MatchMethod(req *http.Request, body []byte, recorded *CassetteRequest) bool {
+	return req.Method == recorded.Method
+}
+
+func MatchHost(req *http.Request, body []byte, recorded *CassetteRequest) bool {
+	u, err := req.URL.Parse(recorded.Url)
+	return err == nil && u.Host == req.URL.Host
+}
+
+func MatchPath(req *http.Request, body []byte, recorded *CassetteRequest) bool {
+	u, err := req.URL.Parse(recorded.Url)
+	return err == nil && u.Path == req.URL.Path
+}
+
+// MatchQuery ignores the order of query parameters
+func MatchQuery(req *http.Request, body []byte, recorded *CassetteRequest) bool {
+	u, err := req.URL.Parse(recorded.Url)
+	return err == nil && reflect.DeepEqual(u.Query(), req.URL.Query())
+}
+
+// MatchBody compares JSON bodies semantically, other bodies byte by byte
+func MatchBody(req *http.Request, body []byte, recorded *CassetteRequest) bool {
+	var a, b interface{}
+	if json.Unmarshal(body, &a) == nil && json.Unmarshal([]byte(recorded.Body), &b) == nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(body) == recorded.Body
+}
+
+var DefaultMatchers = []Matcher{MatchMethod, MatchPath, MatchQuery}
+
+type Cassette struct {
+	// .yaml or .yml file is YAML, others are JSON
+	Path string
+	Mode CassetteMode
+
+	// default is DefaultMatchers
+	Matchers []Matcher
+
+	// real transport used in record mode, default is http.DefaultTransport
+	Transport http.RoundTripper
+
+	// headers not saved into cassette file
+	IgnoreHeaders []string
+
+	mu           sync.Mutex
+	Interactions []*Interaction
+	// replayed interactions, or recorded ones in CassetteRecord mode
+	used []bool
+}
+
+// cassette file content
+type cassetteFile struct {
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// NewCassette loads interactions from path if it exists,
+// in replay mode the file must exist
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{
+		Path:          path,
+		Mode:          mode,
+		IgnoreHeaders: []string{"Authorization", "Cookie", "Set-Cookie"},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && mode != CassetteReplay {
+			return c, nil
+		}
+		return nil, err
+	}
+
+	var cf cassetteFile
+	if c.isYaml() {
+		err = yaml.Unmarshal(data, &cf)
+	} else {
+		err = json.Unmarshal(data, &cf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cassette: load %s failed, %w", path, err)
+	}
+	c.Interactions = cf.Interactions
+	c.used = make([]bool, len(c.Interactions))
+
+	return c, nil
+}
+
+func (c *Cassette) isYaml() bool {
+	ext := strings.ToLower(filepath.Ext(c.Path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if c.Mode != CassetteRecord {
+		if i := c.match(req, body); i != nil {
+			return i.Response.toHttp(req), nil
+		}
+		if c.Mode == CassetteReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, redactURL(req.URL.String()))
+		}
+	}
+
+	return c.record(req, body)
+}
+
+// an unused interaction is preferred, so repeated requests replay in recorded order
+func (c *Cassette) match(req *http.Request, body []byte) *Interaction {
+	matchers := c.Matchers
+	if matchers == nil {
+		matchers = DefaultMatchers
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	matched := -1
+	for idx, i := range c.Interactions {
+		if !matchAll(matchers, req, body, i.Request) {
+			continue
+		}
+		if !c.used[idx] {
+			c.used[idx] = true
+			return i
+		}
+		if matched < 0 {
+			matched = idx
+		}
+	}
+	if matched >= 0 {
+		return c.Interactions[matched]
+	}
+	return nil
+}
+
+func matchAll(matchers []Matcher, req *http.Request, body []byte, recorded *CassetteRequest) bool {
+	for _, m := range matchers {
+		if !m(req, body, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cassette) record(req *http.Request, body []byte) (*http.Response, error) {
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	i := &Interaction{
+		Request: &CassetteRequest{
+			Method:  req.Method,
+			Url:     req.URL.String(),
+			Headers: c.filterHeaders(req.Header),
+			Body:    string(body),
+		},
+		Response: &CassetteResponse{
+			Code:    resp.StatusCode,
+			Headers: c.filterHeaders(resp.Header),
+			Body:    string(respBody),
+		},
+	}
+
+	c.mu.Lock()
+	c.replaceOrAppend(req, body, i)
+	c.mu.Unlock()
+
+	return resp, c.Save()
+}
+
+// in CassetteRecord mode, a matched interaction loaded from file is replaced,
+// so recording again does not duplicate interactions.
+// interactions recorded in this run are kept, repeated requests are appended in order
+func (c *Cassette) replaceOrAppend(req *http.Request, body []byte, i *Interaction) {
+	if c.Mode == CassetteRecord {
+		matchers := c.Matchers
+		if matchers == nil {
+			matchers = DefaultMatchers
+		}
+		for idx, old := range c.Interactions {
+			if !c.used[idx] && matchAll(matchers, req, body, old.Request) {
+				c.Interactions[idx] = i
+				c.used[idx] = true
+				return
+			}
+		}
+	}
+	c.Interactions = append(c.Interactions, i)
+	c.used = append(c.used, true)
+}
+
+func (c *Cassette) filterHeaders(h http.Header) map[string][]string {
+	ret := make(map[string][]string, len(h))
+	for k, v := range h {
+		ret[k] = v
+	}
+	for _, k := range c.IgnoreHeaders {
+		delete(ret, http.CanonicalHeaderKey(k))
+	}
+	return ret
+}
+
+// Save writes all interactions into Path, it is called after every recorded request
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cf := &cassetteFile{Interactions: c.Interactions}
+	var data []byte
+	var err error
+	if c.isYaml() {
+		data, err = yaml.Marshal(cf)
+	} else {
+		data, err = json.MarshalIndent(cf, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.Path, data, 0644)
+}
+
+func (r *CassetteResponse) toHttp(req *http.Request) *http.Response {
+	header := make(http.Header, len(r.Headers))
+	for k, v := range r.Headers {
+		header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Code, http.StatusText(r.Code)),
+		StatusCode:    r.Code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
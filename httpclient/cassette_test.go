@@ -0,0 +1,111 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"q":"` + r.URL.Query().Get("q") + `"}`))
+	}))
+	defer ts.Close()
+
+	for _, name := range []string{"partner.yaml", "partner.json"} {
+		hits = 0
+		path := filepath.Join(t.TempDir(), name)
+
+		recorder, err := NewCassette(path, CassetteRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := NewClient(&ClientOption{Transport: recorder}).Post(&ClientRequest{
+			Ctx:     context.Background(),
+			Url:     ts.URL + "/search?q=go",
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+			Body:    []byte(`{"a":1,"b":2}`),
+		})
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+		if recorder.Interactions[0].Request.Headers["Authorization"] != nil {
+			t.Error("Authorization header should not be recorded")
+		}
+
+		player, err := NewCassette(path, CassetteReplay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		player.Matchers = append(DefaultMatchers, MatchBody)
+		client := NewClient(&ClientOption{Transport: player})
+
+		resp = client.Post(&ClientRequest{
+			Ctx:  context.Background(),
+			Url:  ts.URL + "/search?q=go",
+			Body: []byte(`{"b":2,"a":1}`),
+		})
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+		if string(resp.Body) != `{"q":"go"}` || resp.Raw.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected replay: %s %v", resp.Body, resp.Raw.Header)
+		}
+		if hits != 1 {
+			t.Errorf("replay should not hit server, hits %d", hits)
+		}
+
+		resp = client.Post(&ClientRequest{
+			Ctx:  context.Background(),
+			Url:  ts.URL + "/search?q=go",
+			Body: []byte(`{"a":2}`),
+		})
+		if !errors.Is(resp.Err, ErrNoInteraction) {
+			t.Errorf("expect ErrNoInteraction, got %v", resp.Err)
+		}
+	}
+}
+
+func TestCassetteRecordAgain(t *testing.T) {
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.Write([]byte(strconv.Itoa(n)))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "partner.json")
+	record := func(paths ...string) *Cassette {
+		recorder, err := NewCassette(path, CassetteRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := NewClient(&ClientOption{Transport: recorder})
+		for _, p := range paths {
+			if resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL + p}); resp.Err != nil {
+				t.Fatal(resp.Err)
+			}
+		}
+		return recorder
+	}
+
+	record("/a", "/a", "/b")
+	recorder := record("/a", "/b")
+
+	var bodies []string
+	for _, i := range recorder.Interactions {
+		bodies = append(bodies, i.Response.Body)
+	}
+	// both "/a" of the first run were loaded, only the first one is replaced
+	if got := strings.Join(bodies, ","); got != "4,2,5" {
+		t.Errorf("unexpected interactions after recording again: %s", got)
+	}
+}
@@ -0,0 +1,168 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+type ClientOption struct {
+	// client name, added to logger as "client" field
+	Name string
+
+	// base transport, default is a clone of http.DefaultTransport
+	// configured by the transport options below, which are ignored if Transport is set
+	Transport http.RoundTripper
+
+	// e.g. LoadTLSConfig(cfg.Server.TLS)
+	TLS *tls.Config
+
+	// http://, https:// or socks5:// proxy url, user info is used for proxy authentication.
+	// empty means HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used
+	Proxy string
+
+	// comma separated hosts that are not sent through Proxy, same syntax as NO_PROXY,
+	// e.g. "localhost,.svc.cluster.local,10.0.0.0/8", "*" disables Proxy
+	NoProxy string
+
+	// connect to this unix domain socket instead of url host, proxy is not used,
+	// e.g. "/var/run/docker.sock" with request url "http://docker/v1.41/containers/json"
+	UnixSocket string
+
+	// custom dialer, takes precedence over UnixSocket and Resolver
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// DNS resolver of the default dialer
+	Resolver *net.Resolver
+
+	// responses with larger body fail with *ResponseTooLargeError, default is DefaultMaxResponseSize,
+	// negative means no limit. not applied to Stream requests unless ClientRequest.MaxResponseSize is set
+	MaxResponseSize int64
+
+	// gzip, deflate and br responses are decoded transparently unless DisableDecompression is true,
+	// or the request sets Accept-Encoding itself.
+	// with DisableDecompression no Accept-Encoding is added, a custom Transport should disable its own compression
+	DisableDecompression bool
+
+	// if > 0, request Body not smaller than it is sent gzip compressed with Content-Encoding: gzip
+	GzipRequestMinSize int
+
+	// records requests of this client, labeled by Name, see NewMetrics
+	Metrics *Metrics
+
+	// cookie jar shared by all requests of this client, e.g. NewCookieJar() or NewFileCookieJar(path)
+	Jar http.CookieJar
+
+	// applied to every request of this client, the first one is the outermost.
+	// add LogMiddleware to keep the debug logging of DefaultClient
+	Middlewares []Middleware
+}
+
+// Client sends ClientRequest through its middleware chain,
+// it is safe for concurrent use
+type Client struct {
+	opt  *ClientOption
+	base http.RoundTripper
+	rt   http.RoundTripper
+}
+
+// DefaultClient is used by package level Get/Post/Put/Delete/API/Download
+var DefaultClient = NewClient(&ClientOption{
+	Middlewares: []Middleware{LogMiddleware},
+})
+
+func NewClient(opt *ClientOption) *Client {
+	if opt == nil {
+		opt = &ClientOption{}
+	}
+
+	base := opt.Transport
+	if base == nil {
+		base = newTransport(opt)
+	}
+	if !opt.DisableDecompression {
+		base = decompress(base)
+	}
+	base = limitBody(base)
+
+	return &Client{
+		opt:  opt,
+		base: base,
+		rt:   Chain(base, opt.Middlewares...),
+	}
+}
+
+func (c *Client) Get(req *ClientRequest) *ClientResponse {
+	req.method = http.MethodGet
+	return c.httpRequest(req)
+}
+
+func (c *Client) Post(req *ClientRequest) *ClientResponse {
+	req.method = http.MethodPost
+	return c.httpRequest(req)
+}
+
+func (c *Client) Put(req *ClientRequest) *ClientResponse {
+	req.method = http.MethodPut
+	return c.httpRequest(req)
+}
+
+func (c *Client) Delete(req *ClientRequest) *ClientResponse {
+	req.method = http.MethodDelete
+	return c.httpRequest(req)
+}
+
+func (c *Client) API(req *ClientRequest, method string) *ClientResponse {
+	req.method = method
+	return c.httpRequest(req)
+}
+
+func newTransport(opt *ClientOption) http.RoundTripper {
+	dial := dialContext(opt)
+	if opt.TLS == nil && opt.Proxy == "" && dial == nil && !opt.DisableDecompression {
+		return http.DefaultTransport
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if opt.TLS != nil {
+		t.TLSClientConfig = opt.TLS
+	}
+	if opt.Proxy != "" {
+		t.Proxy = proxyFunc(opt.Proxy, opt.NoProxy)
+	}
+	if dial != nil {
+		t.DialContext = dial
+	}
+	if opt.UnixSocket != "" {
+		t.Proxy = nil
+	}
+	// otherwise http.Transport still asks for gzip and decodes it
+	t.DisableCompression = opt.DisableDecompression
+	return t
+}
+
+func (c *Client) maxResponseSize(req *ClientRequest) int64 {
+	limit := req.MaxResponseSize
+	if limit == 0 && req.Stream == nil {
+		limit = c.opt.MaxResponseSize
+		if limit == 0 {
+			limit = DefaultMaxResponseSize
+		}
+	}
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// per request middlewares are inside client middlewares
+func (c *Client) transport(req *ClientRequest) http.RoundTripper {
+	if len(req.Middlewares) == 0 {
+		return c.rt
+	}
+	middlewares := make([]Middleware, 0, len(c.opt.Middlewares)+len(req.Middlewares))
+	middlewares = append(middlewares, c.opt.Middlewares...)
+	middlewares = append(middlewares, req.Middlewares...)
+	return Chain(c.base, middlewares...)
+}
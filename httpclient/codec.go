@@ -0,0 +1,141 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Codec decodes response body into v,
+// strict means unknown fields are rejected if the format supports it
+type Codec interface {
+	Decode(body []byte, v interface{}, strict bool) error
+}
+
+type CodecFunc func(body []byte, v interface{}, strict bool) error
+
+func (f CodecFunc) Decode(body []byte, v interface{}, strict bool) error {
+	return f(body, v, strict)
+}
+
+var (
+	JSONCodec = CodecFunc(decodeJSON)
+	XMLCodec  = CodecFunc(decodeXML)
+	YAMLCodec = CodecFunc(decodeYAML)
+	FormCodec = CodecFunc(decodeForm)
+	TextCodec = CodecFunc(decodeText)
+)
+
+var (
+	codecMu sync.RWMutex
+	codecs  = map[string]Codec{
+		"application/json":                  JSONCodec,
+		"text/json":                         JSONCodec,
+		"application/xml":                   XMLCodec,
+		"text/xml":                          XMLCodec,
+		"application/yaml":                  YAMLCodec,
+		"application/x-yaml":                YAMLCodec,
+		"text/yaml":                         YAMLCodec,
+		"text/x-yaml":                       YAMLCodec,
+		"application/x-www-form-urlencoded": FormCodec,
+		"text/plain":                        TextCodec,
+		"text/html":                         TextCodec,
+	}
+)
+
+// RegisterCodec sets codec of media type, e.g. "application/msgpack"
+func RegisterCodec(mediaType string, codec Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[strings.ToLower(mediaType)] = codec
+}
+
+// GetCodec returns codec of contentType, structured syntax suffix like
+// application/problem+json is supported. unknown or empty contentType uses JSONCodec
+func GetCodec(contentType string) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return JSONCodec
+	}
+
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	if c, ok := codecs[mediaType]; ok {
+		return c
+	}
+	if idx := strings.LastIndex(mediaType, "+"); idx >= 0 {
+		if c, ok := codecs["application/"+mediaType[idx+1:]]; ok {
+			return c
+		}
+	}
+	return JSONCodec
+}
+
+// Decode decodes body into v by codec of contentType
+func Decode(contentType string, body []byte, v interface{}, strict bool) error {
+	return GetCodec(contentType).Decode(body, v, strict)
+}
+
+func decodeJSON(body []byte, v interface{}, strict bool) error {
+	if !strict {
+		return json.Unmarshal(body, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func decodeXML(body []byte, v interface{}, strict bool) error {
+	return xml.Unmarshal(body, v)
+}
+
+func decodeYAML(body []byte, v interface{}, strict bool) error {
+	if strict {
+		return yaml.UnmarshalStrict(body, v)
+	}
+	return yaml.Unmarshal(body, v)
+}
+
+// v can be *url.Values, *map[string][]string or *map[string]string
+func decodeForm(body []byte, v interface{}, strict bool) error {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case *url.Values:
+		*t = values
+	case *map[string][]string:
+		*t = values
+	case *map[string]string:
+		m := make(map[string]string, len(values))
+		for k := range values {
+			m[k] = values.Get(k)
+		}
+		*t = m
+	default:
+		return fmt.Errorf("form codec can not decode into %T", v)
+	}
+	return nil
+}
+
+// v can be *string or *[]byte, other types are decoded as JSON
+// because many servers send JSON as text/plain
+func decodeText(body []byte, v interface{}, strict bool) error {
+	switch t := v.(type) {
+	case *string:
+		*t = string(body)
+	case *[]byte:
+		*t = append([]byte(nil), body...)
+	default:
+		return decodeJSON(body, v, strict)
+	}
+	return nil
+}
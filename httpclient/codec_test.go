@@ -0,0 +1,78 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func typedRoute(code int, ctype, body string) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		resp := NewMockResponse(req, code, body)
+		resp.Header.Set("Content-Type", ctype)
+		return resp, nil
+	}
+}
+
+func TestContentTypeDecode(t *testing.T) {
+	mock := NewMockTransport().
+		OnFunc("GET", "/xml", typedRoute(200, "application/xml; charset=utf-8", `<user><name>jack</name></user>`)).
+		OnFunc("GET", "/yaml", typedRoute(200, "application/x-yaml", "name: jack\n")).
+		OnFunc("GET", "/form", typedRoute(200, "application/x-www-form-urlencoded", "name=jack&age=12")).
+		OnFunc("GET", "/text", typedRoute(200, "text/plain", "jack")).
+		OnFunc("GET", "/json", typedRoute(200, "application/json", `{"name":"jack","age":12}`)).
+		OnFunc("GET", "/problem", typedRoute(422, "application/problem+json", `{"title":"invalid name"}`))
+	client := NewClient(&ClientOption{Transport: mock})
+
+	type User struct {
+		Name string `json:"name" xml:"name" yaml:"name"`
+	}
+	get := func(path string, v, errV interface{}, strict bool) *ClientResponse {
+		return client.Get(&ClientRequest{
+			Ctx:    context.Background(),
+			Url:    "http://partner.local" + path,
+			V:      v,
+			ErrV:   errV,
+			Strict: strict,
+		})
+	}
+
+	for _, path := range []string{"/xml", "/yaml", "/json"} {
+		var u User
+		if resp := get(path, &u, nil, false); resp.Err != nil || u.Name != "jack" {
+			t.Errorf("%s: unexpected decode %v %v", path, resp.Err, u)
+		}
+	}
+
+	var form map[string]string
+	if resp := get("/form", &form, nil, false); resp.Err != nil || form["age"] != "12" {
+		t.Errorf("unexpected form decode %v %v", resp.Err, form)
+	}
+
+	var text string
+	if resp := get("/text", &text, nil, false); resp.Err != nil || text != "jack" {
+		t.Errorf("unexpected text decode %v %v", resp.Err, text)
+	}
+
+	var strict User
+	if resp := get("/json", &strict, nil, true); resp.Err == nil {
+		t.Error("expect strict decode error of unknown field age")
+	}
+
+	var ok User
+	var problem struct {
+		Title string `json:"title"`
+	}
+	resp := get("/problem", &ok, &problem, false)
+	if resp.Err != nil || problem.Title != "invalid name" || ok.Name != "" {
+		t.Errorf("unexpected error decode %v %v %v", resp.Err, problem, ok)
+	}
+
+	// without ErrV, error payload is decoded into V
+	var fallback struct {
+		Title string `json:"title"`
+	}
+	if resp := get("/problem", &fallback, nil, false); resp.Err != nil || fallback.Title != "invalid name" {
+		t.Errorf("unexpected fallback decode %v %v", resp.Err, fallback)
+	}
+}
@@ -0,0 +1,170 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxResponseSize is used when ClientOption.MaxResponseSize is 0
+const DefaultMaxResponseSize int64 = 64 << 20
+
+const acceptEncoding = "gzip, deflate, br"
+
+// ResponseTooLargeError is returned when response body exceeds the max response size
+type ResponseTooLargeError struct {
+	Limit int64
+	Url   string
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response body of %s exceeds %d bytes", e.Url, e.Limit)
+}
+
+// decompress asks for compressed responses and decodes gzip, deflate and br bodies,
+// responses are left as they are if the caller sets Accept-Encoding
+func decompress(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+			return next.RoundTrip(req)
+		}
+		r := req.Clone(req.Context())
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+
+		resp, err := next.RoundTrip(r)
+		if err != nil {
+			return resp, err
+		}
+
+		encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+		if encoding == "" || encoding == "identity" || req.Method == http.MethodHead ||
+			resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+			return resp, nil
+		}
+
+		body, err := newDecoder(encoding, resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = body
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+		return resp, nil
+	})
+}
+
+// decoder reads decompressed data and closes both decoder and underlying body
+type decoder struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decoder) Close() error {
+	var err error
+	for _, c := range d.closers {
+		if cErr := c.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+func newDecoder(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip response body: %w", err)
+		}
+		return &decoder{Reader: zr, closers: []io.Closer{zr, body}}, nil
+	case "deflate":
+		// deflate is zlib wrapped by spec, some servers send raw deflate
+		br := bufio.NewReader(body)
+		if hdr, err := br.Peek(2); err == nil && isZlibHeader(hdr) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("invalid deflate response body: %w", err)
+			}
+			return &decoder{Reader: zr, closers: []io.Closer{zr, body}}, nil
+		}
+		fr := flate.NewReader(br)
+		return &decoder{Reader: fr, closers: []io.Closer{fr, body}}, nil
+	case "br":
+		return &decoder{Reader: brotli.NewReader(body), closers: []io.Closer{body}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding[%s]", encoding)
+	}
+}
+
+// compression method 8 and header checksum, see RFC 1950
+func isZlibHeader(hdr []byte) bool {
+	return hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0
+}
+
+// limitBody fails reading response body exceeding ClientRequest max response size,
+// so middlewares reading the body are limited too
+func limitBody(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		limit := getReqInfo(req.Context()).MaxResponseSize
+		if err != nil || limit <= 0 {
+			return resp, err
+		}
+
+		tooLarge := &ResponseTooLargeError{Limit: limit, Url: redactURL(req.URL.String())}
+		if resp.ContentLength > limit {
+			resp.Body.Close()
+			return nil, tooLarge
+		}
+		resp.Body = &limitedBody{ReadCloser: resp.Body, n: limit, err: tooLarge}
+		return resp, nil
+	})
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	// bytes left, negative after limit is exceeded
+	n   int64
+	err error
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, l.err
+	}
+	// read one more byte to know whether body exceeds limit
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) > l.n {
+		n = int(l.n)
+		l.n = -1
+		return n, l.err
+	}
+	l.n -= int64(n)
+	return n, err
+}
+
+// gzipBody compresses request body
+func gzipBody(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
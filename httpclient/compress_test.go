@@ -0,0 +1,169 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	payload := strings.Repeat(`{"name":"leyle"}`, 100)
+	encoders := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.URL.Query().Get("encoding")
+		if r.Header.Get("Accept-Encoding") == "" {
+			w.Write([]byte(payload))
+			return
+		}
+		w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+		zw := encoders[encoding](w)
+		zw.Write([]byte(payload))
+		zw.Close()
+	}))
+	defer ts.Close()
+
+	client := NewClient(nil)
+	for encoding := range encoders {
+		resp := client.Get(&ClientRequest{
+			Ctx:   context.Background(),
+			Url:   ts.URL,
+			Query: map[string][]string{"encoding": {encoding}},
+		})
+		if resp.Err != nil || string(resp.Body) != payload {
+			t.Errorf("%s: unexpected response: %v %.32s", encoding, resp.Err, resp.Body)
+		}
+		if resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("%s: Content-Encoding should be removed", encoding)
+		}
+	}
+
+	// caller handles encoding itself
+	resp := client.Get(&ClientRequest{
+		Ctx:     context.Background(),
+		Url:     ts.URL + "?encoding=gzip",
+		Headers: map[string]string{"Accept-Encoding": "gzip"},
+	})
+	zr, err := gzip.NewReader(bytes.NewReader(resp.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(zr)
+	if resp.Header.Get("Content-Encoding") != "gzip" || string(data) != payload {
+		t.Errorf("response should be kept compressed")
+	}
+}
+
+func TestDisableDecompression(t *testing.T) {
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	zw.Write([]byte("hello"))
+	zw.Close()
+
+	var acceptEncoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(zbuf.Bytes())
+	}))
+	defer ts.Close()
+
+	client := NewClient(&ClientOption{DisableDecompression: true})
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL})
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if acceptEncoding != "" {
+		t.Errorf("Accept-Encoding should not be added: %s", acceptEncoding)
+	}
+	if resp.Header.Get("Content-Encoding") != "gzip" || !bytes.Equal(resp.Body, zbuf.Bytes()) {
+		t.Errorf("raw body should be kept: %q %q", resp.Header.Get("Content-Encoding"), resp.Body)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := bytes.Repeat([]byte("a"), 1000)
+		if r.URL.Query().Get("gzip") != "" {
+			// small on the wire, large after decompression
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			zw.Write(data)
+			zw.Close()
+			return
+		}
+		if r.URL.Query().Get("chunked") != "" {
+			w.Write(data[:500])
+			w.(http.Flusher).Flush()
+			w.Write(data[500:])
+			return
+		}
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	client := NewClient(&ClientOption{MaxResponseSize: 999, Middlewares: []Middleware{LogMiddleware}})
+	for _, query := range []string{"", "?gzip=1", "?chunked=1"} {
+		resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL + query, Debug: true})
+		var tooLarge *ResponseTooLargeError
+		if !errors.As(resp.Err, &tooLarge) || tooLarge.Limit != 999 {
+			t.Errorf("%s: expect ResponseTooLargeError, got %v", query, resp.Err)
+		}
+	}
+
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL + "?chunked=1", MaxResponseSize: 1000})
+	if resp.Err != nil || len(resp.Body) != 1000 {
+		t.Errorf("request limit should override client limit: %v %d", resp.Err, len(resp.Body))
+	}
+	resp = client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL, MaxResponseSize: -1})
+	if resp.Err != nil || len(resp.Body) != 1000 {
+		t.Errorf("negative limit means no limit: %v %d", resp.Err, len(resp.Body))
+	}
+}
+
+func TestGzipRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+			w.Header().Set("X-Gzipped", "1")
+		}
+		io.Copy(w, body)
+	}))
+	defer ts.Close()
+
+	client := NewClient(&ClientOption{GzipRequestMinSize: 100})
+	large := strings.Repeat("x", 100)
+	resp := client.Post(&ClientRequest{Ctx: context.Background(), Url: ts.URL, Body: []byte(large)})
+	if resp.Err != nil || string(resp.Body) != large || resp.Header.Get("X-Gzipped") != "1" {
+		t.Errorf("large body should be gzipped: %v %s", resp.Err, resp.Body)
+	}
+
+	resp = client.Post(&ClientRequest{Ctx: context.Background(), Url: ts.URL, Body: []byte("small")})
+	if resp.Err != nil || string(resp.Body) != "small" || resp.Header.Get("X-Gzipped") != "" {
+		t.Errorf("small body should be sent as it is: %v %s", resp.Err, resp.Body)
+	}
+}
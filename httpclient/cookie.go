@@ -0,0 +1,126 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewCookieJar returns an in-memory cookie jar
+func NewCookieJar() http.CookieJar {
+	jar, _ := cookiejar.New(nil)
+	return jar
+}
+
+// FileCookieJar is a cookie jar persisted into a JSON file,
+// the file is rewritten whenever server sets cookies, so sessions survive restarts
+type FileCookieJar struct {
+	path string
+	jar  *cookiejar.Jar
+
+	mu      sync.Mutex
+	entries map[string]*cookieEntry
+}
+
+type cookieEntry struct {
+	Url    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// NewFileCookieJar loads cookies from path if it exists, expired cookies are dropped
+func NewFileCookieJar(path string) (*FileCookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fj := &FileCookieJar{
+		path:    path,
+		jar:     jar,
+		entries: make(map[string]*cookieEntry),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fj, nil
+		}
+		return nil, err
+	}
+
+	var entries []*cookieEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if !e.Cookie.Expires.IsZero() && e.Cookie.Expires.Before(now) {
+			continue
+		}
+		u, err := url.Parse(e.Url)
+		if err != nil {
+			continue
+		}
+		jar.SetCookies(u, []*http.Cookie{e.Cookie})
+		fj.entries[cookieKey(u, e.Cookie)] = e
+	}
+
+	return fj, nil
+}
+
+func cookieKey(u *url.URL, c *http.Cookie) string {
+	return u.Host + "|" + c.Domain + "|" + c.Path + "|" + c.Name
+}
+
+func (j *FileCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		key := cookieKey(u, c)
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(j.entries, key)
+			continue
+		}
+
+		// keep absolute expire time in file
+		saved := *c
+		if saved.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+		saved.Raw = ""
+		j.entries[key] = &cookieEntry{
+			Url:    u.Scheme + "://" + u.Host + u.Path,
+			Cookie: &saved,
+		}
+	}
+
+	// jar keeps working in memory even if file can not be written
+	_ = j.save()
+}
+
+func (j *FileCookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+func (j *FileCookieJar) save() error {
+	entries := make([]*cookieEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(j.path, data, 0600)
+}
@@ -0,0 +1,69 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCookieJarSession(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/", MaxAge: 3600})
+			w.Header().Add("X-Role", "admin")
+			w.Header().Add("X-Role", "user")
+		case "/me":
+			c, err := r.Cookie("session")
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(c.Value + "|" + strings.Join(r.Header["X-Tag"], ",")))
+		}
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	jar, err := NewFileCookieJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(&ClientOption{Jar: jar})
+
+	resp := client.Post(&ClientRequest{
+		Ctx: context.Background(),
+		Url: ts.URL + "/login",
+	})
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if len(resp.Cookies) != 1 || resp.Cookies[0].Value != "s1" {
+		t.Errorf("unexpected cookies: %v", resp.Cookies)
+	}
+	if strings.Join(resp.Header["X-Role"], ",") != "admin,user" {
+		t.Errorf("unexpected headers: %v", resp.Header)
+	}
+
+	// new client loads session from file
+	jar, err = NewFileCookieJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = NewClient(&ClientOption{Jar: jar})
+	resp = client.Get(&ClientRequest{
+		Ctx:          context.Background(),
+		Url:          ts.URL + "/me",
+		HttpHeader:   http.Header{"X-Tag": {"a", "b"}},
+		FailOnNon2xx: true,
+	})
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if string(resp.Body) != "s1|a,b" {
+		t.Errorf("unexpected response: %s", resp.Body)
+	}
+}
@@ -0,0 +1,83 @@
+package httpclient
+
+import (
+	"github.com/leyle/go-api-starter/logmiddleware"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CurlCommand returns a curl command equivalent to req, headers, query and body fields pass through redactor.
+// bodies that cannot be read again (stream bodies) are left out, binary bodies are referred as a file
+func CurlCommand(req *http.Request, redactor *logmiddleware.Redactor) string {
+	if redactor == nil {
+		redactor = logmiddleware.DefaultRedactor
+	}
+
+	var b strings.Builder
+	b.WriteString("curl -X ")
+	b.WriteString(req.Method)
+	b.WriteString(" ")
+	b.WriteString(shellQuote(redactor.URL(req.URL)))
+
+	header := redactor.Header(req.Header)
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			b.WriteString(" -H ")
+			b.WriteString(shellQuote(k + ": " + v))
+		}
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return b.String()
+	}
+	if req.GetBody == nil {
+		b.WriteString(" # stream body omitted")
+		return b.String()
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		b.WriteString(" # body omitted, " + err.Error())
+		return b.String()
+	}
+	body, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	if len(body) == 0 {
+		return b.String()
+	}
+
+	if logmiddleware.IsBinary(body) {
+		b.WriteString(" --data-binary @request.bin # binary body of ")
+		b.WriteString(strconv.Itoa(len(body)))
+		b.WriteString(" bytes is not included, save it as request.bin")
+		return b.String()
+	}
+	b.WriteString(" --data-raw ")
+	b.WriteString(shellQuote(string(curlBody(req, body, redactor))))
+	return b.String()
+}
+
+// the whole body with sensitive fields masked, not truncated like logged bodies
+func curlBody(req *http.Request, body []byte, redactor *logmiddleware.Redactor) []byte {
+	if masked, ok := redactor.JSON(body); ok {
+		return masked
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		return redactor.Form(body)
+	}
+	return redactor.Partial(body)
+}
+
+// single quotes s for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,46 @@
+package httpclient
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCurlCommand(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/login?token=abc&page=1", bytes.NewBufferString(`{"user":"it's me","passwd":"p@ss"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer xyz")
+
+	cmd := CurlCommand(req, nil)
+	expect := `curl -X POST 'http://example.com/login?token=******&page=1'` +
+		` -H 'Authorization: ******' -H 'Content-Type: application/json'` +
+		` --data-raw '{"passwd":"******","user":"it'\''s me"}'`
+	if cmd != expect {
+		t.Errorf("unexpected curl command:\n%s\n%s", cmd, expect)
+	}
+
+	stream, _ := http.NewRequest(http.MethodPut, "http://example.com/upload", strings.NewReader("data"))
+	stream.GetBody = nil
+	if cmd := CurlCommand(stream, nil); !strings.HasSuffix(cmd, "# stream body omitted") {
+		t.Errorf("stream body should be omitted: %s", cmd)
+	}
+
+	// long body is not truncated
+	long := `{"data":"` + strings.Repeat("a", 10000) + `"}`
+	req, _ = http.NewRequest(http.MethodPost, "http://example.com/data", strings.NewReader(long))
+	if cmd := CurlCommand(req, nil); !strings.HasSuffix(cmd, " --data-raw '"+long+"'") {
+		t.Errorf("body should not be truncated: %s", cmd[len(cmd)-50:])
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "http://example.com/form", strings.NewReader("name=jack&passwd=p%40ss"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cmd := CurlCommand(req, nil); !strings.HasSuffix(cmd, " --data-raw 'name=jack&passwd=******'") {
+		t.Errorf("unexpected form body: %s", cmd)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "http://example.com/file", bytes.NewReader([]byte{0x89, 0x00, 0x01}))
+	if cmd := CurlCommand(req, nil); !strings.HasSuffix(cmd, " --data-binary @request.bin # binary body of 3 bytes is not included, save it as request.bin") {
+		t.Errorf("unexpected binary body: %s", cmd)
+	}
+}
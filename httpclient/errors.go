@@ -0,0 +1,103 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/leyle/go-api-starter/logmiddleware"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// max response body bytes kept in StatusError
+const maxStatusErrBody = 1024
+
+// StatusError is returned in ClientResponse.Err when ClientRequest.ExpectStatus
+// or ClientRequest.FailOnNon2xx is set and response status code is not expected
+type StatusError struct {
+	Code   int
+	Method string
+
+	// request url, sensitive query parameters are masked by logmiddleware.DefaultRedactor
+	Url string
+
+	// response body, truncated to maxStatusErrBody bytes.
+	// Error() masks sensitive fields of it, the field itself is kept as it is
+	Body []byte
+
+	// response body parsed as JSON object, nil if it is not
+	Payload map[string]interface{}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s statusCode[%d], body[%s]", e.Method, e.Url, e.Code, logmiddleware.DefaultRedactor.Body(e.Body))
+}
+
+// IsStatusCode reports whether err is, or wraps, a *StatusError with status code
+func IsStatusCode(err error, code int) bool {
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		return serr.Code == code
+	}
+	return false
+}
+
+func (req *ClientRequest) checkStatus(code int) bool {
+	if len(req.ExpectStatus) > 0 {
+		for _, c := range req.ExpectStatus {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+	if req.FailOnNon2xx {
+		return code >= http.StatusOK && code < http.StatusMultipleChoices
+	}
+	return true
+}
+
+func (req *ClientRequest) isSuccess(code int) bool {
+	if len(req.ExpectStatus) > 0 {
+		return req.checkStatus(code)
+	}
+	return code >= http.StatusOK && code < http.StatusMultipleChoices
+}
+
+func newStatusError(raw *http.Response, body []byte) *StatusError {
+	serr := &StatusError{
+		Code:   raw.StatusCode,
+		Method: raw.Request.Method,
+		Url:    logmiddleware.DefaultRedactor.URL(raw.Request.URL),
+		Body:   body,
+	}
+
+	var payload map[string]interface{}
+	if json.Unmarshal(body, &payload) == nil {
+		serr.Payload = payload
+	}
+
+	if len(body) > maxStatusErrBody {
+		serr.Body = body[:maxStatusErrBody]
+	}
+	return serr
+}
+
+// redactErr masks query parameters of url in *url.Error returned by http.Client
+func redactErr(err error) error {
+	uerr, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+	redacted := *uerr
+	redacted.URL = redactURL(uerr.URL)
+	return &redacted
+}
+
+// used by stream mode, response body is not buffered, only read the head of it
+func readStatusError(raw *http.Response, body io.Reader) *StatusError {
+	data, _ := ioutil.ReadAll(io.LimitReader(body, maxStatusErrBody))
+	return newStatusError(raw, data)
+}
@@ -0,0 +1,89 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error":"not_found","reason":"%s"}`, strings.Repeat("x", 2000))
+	}))
+	defer ts.Close()
+
+	var v map[string]interface{}
+	req := &ClientRequest{
+		Ctx:          context.Background(),
+		Url:          ts.URL + "/doc",
+		V:            &v,
+		FailOnNon2xx: true,
+	}
+	resp := Get(req)
+
+	var serr *StatusError
+	if !errors.As(fmt.Errorf("wrapped: %w", resp.Err), &serr) {
+		t.Fatalf("expect *StatusError, got %v", resp.Err)
+	}
+	if serr.Code != http.StatusNotFound || serr.Method != http.MethodGet || serr.Url != ts.URL+"/doc" {
+		t.Errorf("unexpected status error: %d %s %s", serr.Code, serr.Method, serr.Url)
+	}
+	if len(serr.Body) != maxStatusErrBody {
+		t.Errorf("expect body truncated to %d, got %d", maxStatusErrBody, len(serr.Body))
+	}
+	if serr.Payload["error"] != "not_found" {
+		t.Errorf("unexpected payload: %v", serr.Payload["error"])
+	}
+	if v != nil {
+		t.Error("V should not be unmarshalled on unexpected status")
+	}
+	if !IsStatusCode(resp.Err, http.StatusNotFound) {
+		t.Error("expect IsStatusCode 404")
+	}
+
+	// 404 is expected
+	req.ExpectStatus = []int{http.StatusOK, http.StatusNotFound}
+	resp = Get(req)
+	if resp.Err != nil {
+		t.Error(resp.Err)
+	}
+}
+
+func TestErrorsRedacted(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error":"expired","access_token":"leak-body-1","pad":"%s"}`, strings.Repeat("x", 2000))
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	ctx := logger.WithContext(context.Background())
+
+	resp := Get(&ClientRequest{Ctx: ctx, Url: ts.URL + "/me?token=leak-query-2", FailOnNon2xx: true})
+	var serr *StatusError
+	if !errors.As(resp.Err, &serr) || serr.Url != ts.URL+"/me?token=******" {
+		t.Fatalf("unexpected error: %v", resp.Err)
+	}
+
+	resp = Get(&ClientRequest{Ctx: ctx, Url: "http://127.0.0.1:1/me?token=leak-query-3"})
+	var uerr *url.Error
+	if !errors.As(resp.Err, &uerr) {
+		t.Fatalf("expect *url.Error, got %v", resp.Err)
+	}
+
+	out := serr.Error() + resp.Err.Error() + buf.String()
+	for _, leaked := range []string{"leak-body-1", "leak-query-2", "leak-query-3"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("%s leaked: %s", leaked, out)
+		}
+	}
+}
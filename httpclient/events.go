@@ -0,0 +1,284 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// consume text/event-stream and newline-delimited JSON responses on a channel,
+// the channel is closed when request context is done or the stream stops, then Err() tells why
+//   stream := client.SSE(&ClientRequest{Ctx: ctx, Url: "http://upstream/events"})
+//   for ev := range stream.C {
+//       ...
+//   }
+//   if err := stream.Err(); err != nil {...}
+// ClientRequest.Timeout limits the whole stream, leave it 0 for long-lived streams
+
+const defaultSSERetry = 3 * time.Second
+
+// max size of one line of event stream or NDJSON
+const maxStreamLine = 1 << 20
+
+var ErrStreamLineTooLong = errors.New("stream line too long")
+
+// server answered 204 No Content, which tells client to stop reconnecting
+var errNoContent = errors.New("no content")
+
+type Event struct {
+	// last event id, kept until server sends another one
+	Id string
+
+	// default is "message"
+	Event string
+
+	// data lines joined by "\n"
+	Data string
+}
+
+type EventStream struct {
+	C   <-chan *Event
+	err error
+}
+
+// Err returns why the stream stopped, nil if request context is done.
+// it is valid after C is closed
+func (s *EventStream) Err() error {
+	return s.err
+}
+
+// SSE sends GET request and delivers events of text/event-stream response.
+// when connection is lost it reconnects with Last-Event-ID after retry delay (default 3s, or the one sent by server),
+// it stops on a non 2xx response, a 204 response, or when request context is done
+func (c *Client) SSE(req *ClientRequest) *EventStream {
+	ch := make(chan *Event)
+	stream := &EventStream{C: ch}
+
+	ctx := req.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	go func() {
+		defer close(ch)
+
+		var lastId string
+		retry := defaultSSERetry
+		for {
+			header := req.HttpHeader.Clone()
+			if header == nil {
+				header = make(http.Header)
+			}
+			header.Set("Accept", "text/event-stream")
+			header.Set("Cache-Control", "no-cache")
+			if lastId != "" {
+				header.Set("Last-Event-ID", lastId)
+			}
+
+			sReq := *req
+			sReq.Ctx = ctx
+			sReq.HttpHeader = header
+			sReq.ExpectStatus = nil
+			sReq.FailOnNon2xx = true
+			sReq.method = http.MethodGet
+			sReq.Stream = func(resp *ClientResponse, body io.Reader) error {
+				if resp.Code == http.StatusNoContent {
+					return errNoContent
+				}
+				return parseSSE(body, lastId, func(ev *Event) error {
+					lastId = ev.Id
+					select {
+					case ch <- ev:
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}, func(d time.Duration) {
+					retry = d
+				})
+			}
+
+			resp := c.httpRequest(&sReq)
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(resp.Err, errNoContent) {
+				return
+			}
+			var statusErr *StatusError
+			if errors.As(resp.Err, &statusErr) || errors.Is(resp.Err, ErrStreamLineTooLong) {
+				stream.err = resp.Err
+				return
+			}
+
+			resp.Logger.Debug().Err(resp.Err).Str("lastEventId", lastId).Str("retry", retry.String()).Msg("event stream lost, reconnect")
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return stream
+}
+
+// parseSSE reads events from r until EOF or emit returns error,
+// lastId is the event id got before reconnecting, setRetry is called when server changes reconnect delay
+func parseSSE(r io.Reader, lastId string, emit func(ev *Event) error, setRetry func(d time.Duration)) error {
+	reader := bufio.NewReader(r)
+	var (
+		eventType string
+		data      strings.Builder
+		hasData   bool
+	)
+
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			if err == io.EOF {
+				// incomplete event is discarded
+				return nil
+			}
+			return err
+		}
+
+		if line == "" {
+			if hasData {
+				ev := &Event{
+					Id:    lastId,
+					Event: eventType,
+					Data:  strings.TrimSuffix(data.String(), "\n"),
+				}
+				if ev.Event == "" {
+					ev.Event = "message"
+				}
+				if err := emit(ev); err != nil {
+					return err
+				}
+			}
+			eventType, hasData = "", false
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment, usually a keep-alive
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				lastId = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				setRetry(time.Duration(ms) * time.Millisecond)
+			}
+		}
+	}
+}
+
+// readLine returns a line without line ending, io.EOF if nothing is left
+func readLine(reader *bufio.Reader) (string, error) {
+	var buf []byte
+	for {
+		part, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if err == io.EOF && len(buf) > 0 {
+				return string(buf), nil
+			}
+			return "", err
+		}
+		buf = append(buf, part...)
+		if len(buf) > maxStreamLine {
+			return "", ErrStreamLineTooLong
+		}
+		if !isPrefix {
+			return string(buf), nil
+		}
+	}
+}
+
+type NDJSONStream struct {
+	C   <-chan json.RawMessage
+	err error
+}
+
+// Err returns why the stream stopped, nil if the response ended normally or request context is done.
+// it is valid after C is closed
+func (s *NDJSONStream) Err() error {
+	return s.err
+}
+
+// NDJSON sends request and delivers each line of newline-delimited JSON response,
+// empty lines (keep-alive) are skipped. it does not reconnect
+func (c *Client) NDJSON(req *ClientRequest, method string) *NDJSONStream {
+	ch := make(chan json.RawMessage)
+	stream := &NDJSONStream{C: ch}
+
+	ctx := req.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	go func() {
+		defer close(ch)
+
+		nReq := *req
+		nReq.Ctx = ctx
+		nReq.ExpectStatus = nil
+		nReq.FailOnNon2xx = true
+		nReq.method = method
+		nReq.Stream = func(resp *ClientResponse, body io.Reader) error {
+			reader := bufio.NewReader(body)
+			for {
+				line, err := readLine(reader)
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+
+				data := bytes.TrimSpace([]byte(line))
+				if len(data) == 0 {
+					continue
+				}
+				if !json.Valid(data) {
+					return fmt.Errorf("invalid json line: %s", line)
+				}
+				select {
+				case ch <- json.RawMessage(data):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+
+		resp := c.httpRequest(&nReq)
+		if ctx.Err() == nil {
+			stream.err = resp.Err
+		}
+	}()
+
+	return stream
+}
@@ -0,0 +1,137 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	var mu sync.Mutex
+	var lastIds []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastIds = append(lastIds, r.Header.Get("Last-Event-ID"))
+		n := len(lastIds)
+		mu.Unlock()
+		switch n {
+		case 1:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": keep-alive\n\nretry: 10\n\n")
+			fmt.Fprint(w, "id: 1\nevent: order\ndata: {\"a\":1}\n\n")
+			fmt.Fprint(w, "data: line1\r\ndata: line2\r\n\r\n")
+			// incomplete event is dropped when connection is lost
+			fmt.Fprint(w, "id: 3\ndata: lost")
+		case 2:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "id: 4\ndata:no space\n\n")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	stream := SSE(&ClientRequest{Ctx: context.Background(), Url: ts.URL})
+	var events []*Event
+	for ev := range stream.C {
+		events = append(events, ev)
+	}
+	if stream.Err() != nil {
+		t.Fatal(stream.Err())
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expect 3 events, got %d", len(events))
+	}
+	if e := events[0]; e.Id != "1" || e.Event != "order" || e.Data != `{"a":1}` {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if e := events[1]; e.Id != "1" || e.Event != "message" || e.Data != "line1\nline2" {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if e := events[2]; e.Id != "4" || e.Data != "no space" {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lastIds) != 3 || lastIds[0] != "" || lastIds[1] != "1" || lastIds[2] != "4" {
+		t.Errorf("unexpected Last-Event-ID: %v", lastIds)
+	}
+}
+
+func TestSSEStop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/denied" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	stream := SSE(&ClientRequest{Ctx: context.Background(), Url: ts.URL + "/denied"})
+	for range stream.C {
+	}
+	if !IsStatusCode(stream.Err(), http.StatusForbidden) {
+		t.Errorf("expect status error, got %v", stream.Err())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream = SSE(&ClientRequest{Ctx: ctx, Url: ts.URL})
+	received := 0
+	for range stream.C {
+		received++
+		if received == 3 {
+			cancel()
+		}
+	}
+	if stream.Err() != nil || received < 3 {
+		t.Errorf("stream should stop with context: %v %d", stream.Err(), received)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, "{\"seq\":1}\n\n{\"seq\":2}\r\n")
+		if r.URL.Query().Get("broken") != "" {
+			fmt.Fprint(w, "{broken\n")
+		}
+	}))
+	defer ts.Close()
+
+	stream := NDJSON(&ClientRequest{Ctx: context.Background(), Url: ts.URL}, http.MethodGet)
+	var seqs []int
+	for line := range stream.C {
+		var v struct {
+			Seq int `json:"seq"`
+		}
+		if err := json.Unmarshal(line, &v); err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, v.Seq)
+	}
+	if stream.Err() != nil || len(seqs) != 2 || seqs[1] != 2 {
+		t.Errorf("unexpected result: %v %v", seqs, stream.Err())
+	}
+
+	stream = NDJSON(&ClientRequest{Ctx: context.Background(), Url: ts.URL + "?broken=1"}, http.MethodGet)
+	for range stream.C {
+	}
+	if stream.Err() == nil {
+		t.Error("invalid json line should stop the stream")
+	}
+}
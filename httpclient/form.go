@@ -0,0 +1,225 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	ContentTypeForm      = "application/x-www-form-urlencoded"
+	ContentTypeMultipart = "multipart/form-data"
+)
+
+func setContentType(req *ClientRequest, ctype string) {
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	req.Headers["Content-Type"] = ctype
+}
+
+// application/x-www-form-urlencoded body builder
+type FormBuilder struct {
+	values url.Values
+}
+
+func NewForm() *FormBuilder {
+	return &FormBuilder{
+		values: url.Values{},
+	}
+}
+
+func (f *FormBuilder) Add(key, value string) *FormBuilder {
+	f.values.Add(key, value)
+	return f
+}
+
+func (f *FormBuilder) Set(key, value string) *FormBuilder {
+	f.values.Set(key, value)
+	return f
+}
+
+// Apply writes encoded form into req.Body and sets Content-Type
+func (f *FormBuilder) Apply(req *ClientRequest) {
+	req.Body = []byte(f.values.Encode())
+	setContentType(req, ContentTypeForm)
+}
+
+// ApplyStream writes encoded form into req.BodyReader and sets Content-Type
+func (f *FormBuilder) ApplyStream(req *ClientRequest) {
+	data := f.values.Encode()
+	req.Body = nil
+	req.BodyReader = strings.NewReader(data)
+	req.BodyLength = int64(len(data))
+	setContentType(req, ContentTypeForm)
+}
+
+// multipart/form-data body builder
+// files are opened when body is generated, not when they are added
+type MultipartBuilder struct {
+	parts    []func(w *multipart.Writer) error
+	boundary string
+}
+
+func NewMultipart() *MultipartBuilder {
+	return &MultipartBuilder{}
+}
+
+// SetBoundary uses a fixed boundary instead of a random one
+func (m *MultipartBuilder) SetBoundary(boundary string) *MultipartBuilder {
+	m.boundary = boundary
+	return m
+}
+
+func (m *MultipartBuilder) AddField(name, value string) *MultipartBuilder {
+	m.parts = append(m.parts, func(w *multipart.Writer) error {
+		return w.WriteField(name, value)
+	})
+	return m
+}
+
+// AddFile adds a file part read from path, file name is the base name of path
+func (m *MultipartBuilder) AddFile(fieldName, path string) *MultipartBuilder {
+	m.parts = append(m.parts, func(w *multipart.Writer) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		pw, err := w.CreatePart(filePartHeader(fieldName, filepath.Base(path)))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(pw, f)
+		return err
+	})
+	return m
+}
+
+// AddReader adds a file part read from r
+func (m *MultipartBuilder) AddReader(fieldName, fileName string, r io.Reader) *MultipartBuilder {
+	m.parts = append(m.parts, func(w *multipart.Writer) error {
+		pw, err := w.CreatePart(filePartHeader(fieldName, fileName))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(pw, r)
+		return err
+	})
+	return m
+}
+
+// AddPart adds a part with custom headers, e.g. Content-Disposition, Content-Type, Content-ID
+func (m *MultipartBuilder) AddPart(header textproto.MIMEHeader, r io.Reader) *MultipartBuilder {
+	m.parts = append(m.parts, func(w *multipart.Writer) error {
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(pw, r)
+		return err
+	})
+	return m
+}
+
+// Apply generates the whole body into req.Body and sets Content-Type with boundary
+func (m *MultipartBuilder) Apply(req *ClientRequest) error {
+	var buf bytes.Buffer
+	w, err := m.newWriter(&buf)
+	if err != nil {
+		return err
+	}
+	if err = m.writeParts(w); err != nil {
+		return err
+	}
+
+	req.Body = buf.Bytes()
+	setContentType(req, w.FormDataContentType())
+	return nil
+}
+
+// ApplyStream sets req.BodyReader to a pipe that generates body while request is sending,
+// errors of reading files abort the request.
+// the writer starts on the first read, so a request never sent leaks nothing,
+// and it stops when the body is closed, which http.Client does after sending or failing
+func (m *MultipartBuilder) ApplyStream(req *ClientRequest) error {
+	pr, pw := io.Pipe()
+	w, err := m.newWriter(pw)
+	if err != nil {
+		return err
+	}
+
+	req.Body = nil
+	req.BodyReader = &lazyPipeReader{
+		pr: pr,
+		start: func() {
+			go func() {
+				pw.CloseWithError(m.writeParts(w))
+			}()
+		},
+	}
+	req.BodyLength = 0
+	setContentType(req, w.FormDataContentType())
+	return nil
+}
+
+// starts the pipe writer on the first Read
+type lazyPipeReader struct {
+	once  sync.Once
+	pr    *io.PipeReader
+	start func()
+}
+
+func (l *lazyPipeReader) Read(p []byte) (int, error) {
+	l.once.Do(l.start)
+	return l.pr.Read(p)
+}
+
+// Close unblocks the writer if it is started, the writer is never started after Close
+func (l *lazyPipeReader) Close() error {
+	l.once.Do(func() {})
+	return l.pr.Close()
+}
+
+func (m *MultipartBuilder) newWriter(out io.Writer) (*multipart.Writer, error) {
+	w := multipart.NewWriter(out)
+	if m.boundary != "" {
+		if err := w.SetBoundary(m.boundary); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (m *MultipartBuilder) writeParts(w *multipart.Writer) error {
+	for _, part := range m.parts {
+		if err := part(w); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func filePartHeader(fieldName, fileName string) textproto.MIMEHeader {
+	ctype := mime.TypeByExtension(filepath.Ext(fileName))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(fieldName), quoteEscaper.Replace(fileName)))
+	h.Set("Content-Type", ctype)
+	return h
+}
@@ -0,0 +1,144 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormBuilder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(r.PostForm.Get("name") + "," + strings.Join(r.PostForm["age"], ",")))
+	}))
+	defer ts.Close()
+
+	req := &ClientRequest{
+		Ctx: context.Background(),
+		Url: ts.URL,
+	}
+	NewForm().Set("name", "jack").Add("age", "12").Add("age", "23").Apply(req)
+
+	resp := Post(req)
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if string(resp.Body) != "jack,12,23" {
+		t.Errorf("unexpected response: %s", resp.Body)
+	}
+}
+
+func TestMultipartBuilder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+			return
+		}
+		doc, dh, err := r.FormFile("doc")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		docData, _ := ioutil.ReadAll(doc)
+		raw, _, err := r.FormFile("raw")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rawData, _ := ioutil.ReadAll(raw)
+
+		w.Write([]byte(strings.Join([]string{
+			r.FormValue("name"), dh.Filename, dh.Header.Get("Content-Type"), string(docData), string(rawData),
+		}, ",")))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "jack,doc.txt,text/plain; charset=utf-8,hello,world"
+	for _, stream := range []bool{false, true} {
+		mb := NewMultipart().
+			AddField("name", "jack").
+			AddFile("doc", path).
+			AddReader("raw", "raw.bin", strings.NewReader("world"))
+
+		req := &ClientRequest{
+			Ctx: context.Background(),
+			Url: ts.URL,
+		}
+		var err error
+		if stream {
+			err = mb.ApplyStream(req)
+		} else {
+			err = mb.Apply(req)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(req.Headers["Content-Type"], "multipart/form-data; boundary=") {
+			t.Errorf("unexpected content type: %s", req.Headers["Content-Type"])
+		}
+
+		resp := Post(req)
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+		if string(resp.Body) != expect {
+			t.Errorf("stream[%v] unexpected response: %s", stream, resp.Body)
+		}
+	}
+}
+
+func TestMultipartBuilderMissingFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	req := &ClientRequest{
+		Ctx: context.Background(),
+		Url: ts.URL,
+	}
+	if err := NewMultipart().AddFile("doc", "/not/exist").Apply(req); err == nil {
+		t.Error("expect error of missing file")
+	}
+}
+
+func TestMultipartStreamNotSent(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	req := &ClientRequest{}
+	if err := NewMultipart().AddField("name", strings.Repeat("a", 1000)).ApplyStream(req); err != nil {
+		t.Fatal(err)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("writer should not start before the body is read, goroutines %d -> %d", before, n)
+	}
+
+	// read a little, then abandon it
+	body := req.BodyReader.(io.ReadCloser)
+	if _, err := body.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("writer should stop after the body is closed, goroutines %d -> %d", before, n)
+	}
+	if _, err := body.Read(make([]byte, 10)); err != io.ErrClosedPipe {
+		t.Errorf("expect closed pipe, got %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/leyle/go-api-starter/logmiddleware"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// record requests and responses of a session, then export them as a HAR 1.2 file,
+// which can be opened by browser devtools or imported into postman
+//   har := NewHARRecorder(nil)
+//   client := NewClient(&ClientOption{Middlewares: []Middleware{LogMiddleware, har.Middleware}})
+//   ...
+//   err := har.Save("session.har")
+// headers, query and JSON body fields pass through the redactor, cookies are only kept in redacted headers.
+// bodies of stream requests and responses are not recorded
+
+const harVersion = "1.2"
+
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime string       `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HARRequest  `json:"request"`
+	Response        *HARResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HARTimings  `json:"timings"`
+
+	// transport error, HAR has no field for it
+	Error string `json:"_error,omitempty"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARRequest struct {
+	Method      string          `json:"method"`
+	Url         string          `json:"url"`
+	HttpVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	QueryString []*HARNameValue `json:"queryString"`
+	PostData    *HARPostData    `json:"postData,omitempty"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HttpVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	Content     *HARContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// times in milliseconds, -1 means not available
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type HARRecorder struct {
+	redactor *logmiddleware.Redactor
+
+	mu      sync.Mutex
+	entries []*HAREntry
+}
+
+// NewHARRecorder uses logmiddleware.DefaultRedactor if redactor is nil
+func NewHARRecorder(redactor *logmiddleware.Redactor) *HARRecorder {
+	if redactor == nil {
+		redactor = logmiddleware.DefaultRedactor
+	}
+	return &HARRecorder{
+		redactor: redactor,
+	}
+}
+
+func (h *HARRecorder) Middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		startT := time.Now()
+		entry := &HAREntry{
+			StartedDateTime: startT.Format(time.RFC3339Nano),
+			Request:         h.request(req),
+			Timings:         &HARTimings{Send: -1, Wait: -1, Receive: -1},
+		}
+
+		resp, err := next.RoundTrip(req)
+		waitT := time.Since(startT)
+		entry.Timings.Wait = ms(waitT)
+		if err != nil {
+			entry.Time = ms(waitT)
+			entry.Response = &HARResponse{
+				Cookies: []*HARNameValue{},
+				Headers: []*HARNameValue{},
+				Content: &HARContent{},
+			}
+			entry.Error = err.Error()
+			h.add(entry)
+			return resp, err
+		}
+
+		entry.Response = &HARResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HttpVersion: resp.Proto,
+			Cookies:     []*HARNameValue{},
+			Headers:     h.headers(resp.Header),
+			Content: &HARContent{
+				Size:     resp.ContentLength,
+				MimeType: resp.Header.Get("Content-Type"),
+			},
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    resp.ContentLength,
+		}
+
+		if !getReqInfo(req.Context()).Stream {
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			entry.Response.BodySize = int64(len(body))
+			entry.Response.Content.Size = int64(len(body))
+			entry.Response.Content.Text, entry.Response.Content.Encoding = h.content(body)
+		}
+
+		entry.Time = ms(time.Since(startT))
+		entry.Timings.Receive = entry.Time - entry.Timings.Wait
+		h.add(entry)
+		return resp, nil
+	})
+}
+
+func (h *HARRecorder) request(req *http.Request) *HARRequest {
+	rawUrl := h.redactor.URL(req.URL)
+	r := &HARRequest{
+		Method:      req.Method,
+		Url:         rawUrl,
+		HttpVersion: "HTTP/1.1",
+		Cookies:     []*HARNameValue{},
+		Headers:     h.headers(req.Header),
+		QueryString: []*HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    req.ContentLength,
+	}
+
+	if u, err := url.Parse(rawUrl); err == nil {
+		for k, vs := range u.Query() {
+			for _, v := range vs {
+				r.QueryString = append(r.QueryString, &HARNameValue{Name: k, Value: v})
+			}
+		}
+	}
+	sort.SliceStable(r.QueryString, func(i, j int) bool {
+		return r.QueryString[i].Name < r.QueryString[j].Name
+	})
+
+	if req.Body != nil && req.Body != http.NoBody {
+		r.PostData = &HARPostData{MimeType: req.Header.Get("Content-Type")}
+		if req.GetBody == nil {
+			r.PostData.Text = "[stream body]"
+		} else if rc, err := req.GetBody(); err == nil {
+			body, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			r.PostData.Text, _ = h.content(body)
+		}
+	}
+	return r
+}
+
+func (h *HARRecorder) headers(header http.Header) []*HARNameValue {
+	masked := h.redactor.Header(header)
+	keys := make([]string, 0, len(masked))
+	for k := range masked {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ret := make([]*HARNameValue, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range masked[k] {
+			ret = append(ret, &HARNameValue{Name: k, Value: v})
+		}
+	}
+	return ret
+}
+
+// content returns text of body, JSON fields are masked, binary data is base64 encoded
+func (h *HARRecorder) content(body []byte) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	if masked, ok := h.redactor.JSON(body); ok {
+		return string(masked), ""
+	}
+	if logmiddleware.IsBinary(body) || !utf8.Valid(body) {
+		return base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return string(body), ""
+}
+
+func (h *HARRecorder) add(entry *HAREntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+}
+
+// HAR returns recorded entries so far
+func (h *HARRecorder) HAR() *HAR {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := make([]*HAREntry, len(h.entries))
+	copy(entries, h.entries)
+	return &HAR{
+		Log: &HARLog{
+			Version: harVersion,
+			Creator: &HARCreator{Name: "go-api-starter/httpclient", Version: harVersion},
+			Entries: entries,
+		},
+	}
+}
+
+// Reset drops recorded entries
+func (h *HARRecorder) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = nil
+}
+
+// Save writes recorded entries into path as a HAR file
+func (h *HARRecorder) Save(path string) error {
+	data, err := json.MarshalIndent(h.HAR(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,74 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHARRecorder(t *testing.T) {
+	mock := NewMockTransport()
+	mock.On(http.MethodPost, "/login", 200, `{"access_token":"t0ken","name":"leyle"}`)
+	failing := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/down" {
+				return nil, errors.New("connection refused")
+			}
+			return next.RoundTrip(req)
+		})
+	}
+
+	har := NewHARRecorder(nil)
+	client := NewClient(&ClientOption{
+		Transport:   mock,
+		Middlewares: []Middleware{har.Middleware, failing},
+	})
+
+	resp := client.Post(&ClientRequest{
+		Ctx:     context.Background(),
+		Url:     "http://example.com/login?secret=s1&lang=en",
+		Headers: map[string]string{"Authorization": "Basic dXNlcg==", "Content-Type": "application/json"},
+		Body:    []byte(`{"user":"leyle","password":"p@ss"}`),
+	})
+	if resp.Err != nil || !strings.Contains(string(resp.Body), "t0ken") {
+		t.Fatalf("response body should be kept for caller: %v %s", resp.Err, resp.Body)
+	}
+	client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://example.com/down"})
+
+	path := filepath.Join(t.TempDir(), "session.har")
+	if err := har.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	for _, secret := range []string{"s1", "dXNlcg==", "p@ss", "t0ken"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("secret %s is not redacted", secret)
+		}
+	}
+
+	var saved HAR
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	entries := saved.Log.Entries
+	if saved.Log.Version != "1.2" || len(entries) != 2 {
+		t.Fatalf("unexpected HAR log: %s", data)
+	}
+	if entries[0].Response.Status != 200 || !strings.Contains(entries[0].Response.Content.Text, "leyle") ||
+		entries[0].Request.PostData == nil || len(entries[0].Request.QueryString) != 2 {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+	if entries[1].Error != "connection refused" {
+		t.Errorf("transport error should be recorded: %+v", entries[1])
+	}
+
+	har.Reset()
+	if len(har.HAR().Log.Entries) != 0 {
+		t.Error("entries should be dropped by Reset")
+	}
+}
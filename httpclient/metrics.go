@@ -0,0 +1,216 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// outbound request metrics in Prometheus text format, without depending on prometheus client
+//   metrics := NewMetrics(nil)
+//   client := NewClient(&ClientOption{Name: "couchdb", Metrics: metrics, Middlewares: []Middleware{LogMiddleware}})
+//   e.GET("/metrics", gin.WrapH(metrics.Handler()))
+// exposed series:
+//   httpclient_requests_total{client,method,host,status}                counter, status is 2xx...5xx or error
+//   httpclient_request_duration_seconds{client,method,host,status}      histogram
+//   httpclient_phase_duration_seconds{client,method,host,phase}         histogram, phase is dns/connect/tls/ttfb/body
+//   httpclient_connections_total{client,host,reused}                    counter
+
+// DefaultBuckets are the default prometheus histogram buckets in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Metrics struct {
+	buckets []float64
+
+	mu          sync.Mutex
+	requests    map[string]*counter
+	durations   map[string]*histogram
+	phases      map[string]*histogram
+	connections map[string]*counter
+}
+
+type counter struct {
+	labels []string
+	value  uint64
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+var (
+	requestLabels    = []string{"client", "method", "host", "status"}
+	phaseLabels      = []string{"client", "method", "host", "phase"}
+	connectionLabels = []string{"client", "host", "reused"}
+)
+
+// NewMetrics uses DefaultBuckets if buckets is empty
+func NewMetrics(buckets []float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Metrics{
+		buckets:     sorted,
+		requests:    make(map[string]*counter),
+		durations:   make(map[string]*histogram),
+		phases:      make(map[string]*histogram),
+		connections: make(map[string]*counter),
+	}
+}
+
+// Observe records a finished request, it is called by Client with ClientOption.Metrics
+func (m *Metrics) Observe(client, method, rawUrl string, code int, timing *Timing) {
+	host := rawUrl
+	if u, err := url.Parse(rawUrl); err == nil {
+		host = u.Host
+	}
+	status := "error"
+	if code > 0 {
+		status = fmt.Sprintf("%dxx", code/100)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.incr(m.requests, []string{client, method, host, status})
+	m.histogram(m.durations, []string{client, method, host, status}).observe(m.buckets, timing.Total.Seconds())
+
+	phases := []struct {
+		name  string
+		value float64
+	}{
+		{"dns", timing.DNS.Seconds()},
+		{"connect", timing.Connect.Seconds()},
+		{"tls", timing.TLS.Seconds()},
+		{"ttfb", timing.TTFB.Seconds()},
+		{"body", timing.BodyRead.Seconds()},
+	}
+	for _, p := range phases {
+		if p.value > 0 {
+			m.histogram(m.phases, []string{client, method, host, p.name}).observe(m.buckets, p.value)
+		}
+	}
+
+	if code > 0 {
+		m.incr(m.connections, []string{client, host, strconv.FormatBool(timing.Reused)})
+	}
+}
+
+func (m *Metrics) incr(counters map[string]*counter, labels []string) {
+	key := strings.Join(labels, "\xff")
+	c, ok := counters[key]
+	if !ok {
+		c = &counter{labels: labels}
+		counters[key] = c
+	}
+	c.value++
+}
+
+func (m *Metrics) histogram(histograms map[string]*histogram, labels []string) *histogram {
+	key := strings.Join(labels, "\xff")
+	h, ok := histograms[key]
+	if !ok {
+		h = &histogram{labels: labels, counts: make([]uint64, len(m.buckets))}
+		histograms[key] = h
+	}
+	return h
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	for i, upper := range buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// WritePrometheus writes all series in Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	writeCounters(&b, "httpclient_requests_total", "Outbound HTTP requests.", requestLabels, m.requests)
+	m.writeHistograms(&b, "httpclient_request_duration_seconds", "Outbound HTTP request duration.", requestLabels, m.durations)
+	m.writeHistograms(&b, "httpclient_phase_duration_seconds", "Outbound HTTP request phase duration.", phaseLabels, m.phases)
+	writeCounters(&b, "httpclient_connections_total", "Connections used by outbound HTTP requests.", connectionLabels, m.connections)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves metrics for prometheus scraping
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+	})
+}
+
+func writeCounters(b *strings.Builder, name, help string, names []string, counters map[string]*counter) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(counters) {
+		c := counters[key]
+		fmt.Fprintf(b, "%s{%s} %d\n", name, formatLabels(names, c.labels), c.value)
+	}
+}
+
+func (m *Metrics) writeHistograms(b *strings.Builder, name, help string, names []string, histograms map[string]*histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, key := range sortedKeys(histograms) {
+		h := histograms[key]
+		labels := formatLabels(names, h.labels)
+		for i, upper := range m.buckets {
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(upper), h.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(b, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+func sortedKeys(v interface{}) []string {
+	var keys []string
+	switch m := v.(type) {
+	case map[string]*counter:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*histogram:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabels(names, values []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,71 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTimingAndMetrics(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	metrics := NewMetrics([]float64{0.1, 1})
+	client := NewClient(&ClientOption{
+		Name:      "partner",
+		Transport: ts.Client().Transport,
+		Metrics:   metrics,
+	})
+
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL + "/ok"})
+	if resp.Err != nil || resp.Timing == nil {
+		t.Fatalf("unexpected response: %v %+v", resp.Err, resp.Timing)
+	}
+	if timing := resp.Timing; timing.Reused || timing.Connect <= 0 || timing.TLS <= 0 ||
+		timing.TTFB <= 0 || timing.Total < timing.TTFB {
+		t.Errorf("unexpected timing of new connection: %+v", timing)
+	}
+
+	resp = client.Get(&ClientRequest{Ctx: context.Background(), Url: ts.URL + "/missing"})
+	if !resp.Timing.Reused || resp.Timing.Connect != 0 {
+		t.Errorf("connection should be reused: %+v", resp.Timing)
+	}
+
+	// transport error
+	client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://127.0.0.1:1/"})
+
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(rr.Body)
+	out := string(body)
+
+	u, _ := url.Parse(ts.URL)
+	host := u.Host
+	expects := []string{
+		`httpclient_requests_total{client="partner",method="GET",host="` + host + `",status="2xx"} 1`,
+		`httpclient_requests_total{client="partner",method="GET",host="` + host + `",status="4xx"} 1`,
+		`httpclient_requests_total{client="partner",method="GET",host="127.0.0.1:1",status="error"} 1`,
+		`httpclient_request_duration_seconds_bucket{client="partner",method="GET",host="` + host + `",status="2xx",le="+Inf"} 1`,
+		`httpclient_request_duration_seconds_count{client="partner",method="GET",host="` + host + `",status="4xx"} 1`,
+		`httpclient_phase_duration_seconds_count{client="partner",method="GET",host="` + host + `",phase="tls"} 1`,
+		`httpclient_phase_duration_seconds_count{client="partner",method="GET",host="` + host + `",phase="ttfb"} 2`,
+		`httpclient_connections_total{client="partner",host="` + host + `",reused="false"} 1`,
+		`httpclient_connections_total{client="partner",host="` + host + `",reused="true"} 1`,
+		"# TYPE httpclient_request_duration_seconds histogram",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(out, expect) {
+			t.Errorf("missing %s in:\n%s", expect, out)
+		}
+	}
+}
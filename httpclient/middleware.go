@@ -0,0 +1,122 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/leyle/go-api-starter/logmiddleware"
+	"github.com/rs/zerolog"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// RoundTripperFunc is an adapter to use ordinary function as http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the next http.RoundTripper, it can modify outbound request,
+// inspect the response, or return without calling next.
+// logger of current request can be got by zerolog.Ctx(req.Context())
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Chain wraps rt with middlewares, the first middleware is the outermost
+func Chain(rt http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		rt = middlewares[i](rt)
+	}
+	return rt
+}
+
+type ctxKey int
+
+const reqInfoKey ctxKey = iota
+
+// ClientRequest options that middlewares need
+type reqInfo struct {
+	Debug  bool
+	Stream bool
+	Curl   bool
+
+	// max response body size, 0 means no limit
+	MaxResponseSize int64
+}
+
+func getReqInfo(ctx context.Context) *reqInfo {
+	if info, ok := ctx.Value(reqInfoKey).(*reqInfo); ok {
+		return info
+	}
+	return &reqInfo{}
+}
+
+// LogMiddleware is the debug logging middleware using logmiddleware.DefaultRedactor
+var LogMiddleware = NewLogMiddleware(logmiddleware.DefaultRedactor)
+
+// NewLogMiddleware logs request start, status code and elapsed time at debug level.
+// if ClientRequest.Debug is true, it also logs headers and bodies of request and response,
+// all of them pass through redactor. bodies of stream requests are not logged.
+// if ClientRequest.Curl is true, an equivalent curl command is logged too
+func NewLogMiddleware(redactor *logmiddleware.Redactor) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			startT := time.Now()
+			logger := zerolog.Ctx(req.Context())
+			info := getReqInfo(req.Context())
+
+			event := logger.Debug().Str("fullUrl", redactor.URL(req.URL))
+			if info.Debug {
+				headers, _ := json.Marshal(redactor.Header(req.Header))
+				event.RawJSON("requestHeaders", headers).Str("requestBody", requestBody(req, redactor))
+			}
+			if info.Curl {
+				event.Str("curl", CurlCommand(req, redactor))
+			}
+			event.Msg("start http request...")
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return resp, err
+			}
+
+			event = logger.Debug().Int("statusCode", resp.StatusCode).Str("elapsed", time.Since(startT).String())
+			if info.Debug {
+				headers, _ := json.Marshal(redactor.Header(resp.Header))
+				event.RawJSON("responseHeaders", headers)
+			}
+			event.Msg("http response")
+
+			if info.Debug && !info.Stream {
+				body, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+				logger.Debug().Str("responseBody", redactor.Body(body)).Send()
+			}
+
+			return resp, nil
+		})
+	}
+}
+
+// only buffered bodies can be read again by GetBody
+func requestBody(req *http.Request, redactor *logmiddleware.Redactor) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+	if req.GetBody == nil {
+		return "[stream body]"
+	}
+
+	rc, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	body, _ := ioutil.ReadAll(rc)
+	return redactor.Body(body)
+}
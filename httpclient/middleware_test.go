@@ -0,0 +1,130 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization") + "|" + strings.Join(r.Header["X-Trace"], ",")))
+	}))
+	defer ts.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				req.Header.Add("X-Trace", name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	auth := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("Authorization", "Bearer token")
+			return next.RoundTrip(req)
+		})
+	}
+
+	client := NewClient(&ClientOption{
+		Name:        "test",
+		Middlewares: []Middleware{LogMiddleware, trace("client"), auth},
+	})
+
+	resp := client.Get(&ClientRequest{
+		Ctx:         context.Background(),
+		Url:         ts.URL,
+		Middlewares: []Middleware{trace("request")},
+		Debug:       true,
+	})
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+
+	if string(resp.Body) != "Bearer token|client,request" {
+		t.Errorf("unexpected response: %s", resp.Body)
+	}
+	if strings.Join(order, ",") != "client,request" {
+		t.Errorf("unexpected middleware order: %v", order)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	fault := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     make(http.Header),
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		})
+	}
+
+	client := NewClient(&ClientOption{Middlewares: []Middleware{fault}})
+	resp := client.Get(&ClientRequest{
+		Ctx:          context.Background(),
+		Url:          "http://fault.invalid/",
+		FailOnNon2xx: true,
+	})
+	if !IsStatusCode(resp.Err, http.StatusServiceUnavailable) {
+		t.Errorf("expect injected 503, got %v", resp.Err)
+	}
+}
+
+func TestLogMiddlewareRedact(t *testing.T) {
+	mock := NewMockTransport().On("POST", "/login", 200, `{"token":"resp-token","name":"jack"}`)
+	client := NewClient(&ClientOption{
+		Transport:   mock,
+		Middlewares: []Middleware{LogMiddleware},
+	})
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	resp := client.Post(&ClientRequest{
+		Ctx:     logger.WithContext(context.Background()),
+		Url:     "http://partner.local/login?access_token=query-token",
+		Headers: map[string]string{"Authorization": "Basic YWRtaW46cGFzc3dk"},
+		Body:    []byte(`{"name":"jack","passwd":"req-passwd"}`),
+		Debug:   true,
+	})
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if string(resp.Body) != `{"token":"resp-token","name":"jack"}` {
+		t.Errorf("response body should not be redacted: %s", resp.Body)
+	}
+
+	out := buf.String()
+	for _, leaked := range []string{"resp-token", "query-token", "YWRtaW46cGFzc3dk", "req-passwd"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("%s leaked in log: %s", leaked, out)
+		}
+	}
+	if !strings.Contains(out, "jack") {
+		t.Errorf("expect bodies logged: %s", out)
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	mock := NewMockTransport().On("GET", "/", 200, "ok")
+	client := NewClient(&ClientOption{Transport: mock})
+	client.Get(&ClientRequest{
+		Ctx:        context.Background(),
+		Url:        "http://partner.local/",
+		Headers:    map[string]string{"X-A": "1", "X-B": "1"},
+		HttpHeader: http.Header{"X-A": {"2", "3"}},
+	})
+
+	header := mock.Calls()[0].Header
+	if a := header.Values("X-A"); len(a) != 2 || a[0] != "2" || a[1] != "3" || header.Get("X-B") != "1" {
+		t.Errorf("HttpHeader should win over Headers: %v", header)
+	}
+}
@@ -0,0 +1,126 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MockTransport is a programmable http.RoundTripper for unit tests,
+// use it as ClientOption.Transport and assert calls made by Calls/CallCount
+type MockTransport struct {
+	mu     sync.Mutex
+	routes []*mockRoute
+	calls  []*MockCall
+}
+
+type MockCall struct {
+	Method string
+	Url    string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+type mockRoute struct {
+	method  string
+	path    string
+	handler func(req *http.Request) (*http.Response, error)
+}
+
+func NewMockTransport() *MockTransport {
+	return &MockTransport{}
+}
+
+// On answers requests of method and url path with code and body,
+// empty method matches any method
+func (m *MockTransport) On(method, path string, code int, body string) *MockTransport {
+	return m.OnFunc(method, path, func(req *http.Request) (*http.Response, error) {
+		return NewMockResponse(req, code, body), nil
+	})
+}
+
+// OnFunc answers requests of method and url path by fn, e.g. to return a transport error
+func (m *MockTransport) OnFunc(method, path string, fn func(req *http.Request) (*http.Response, error)) *MockTransport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes = append(m.routes, &mockRoute{
+		method:  method,
+		path:    path,
+		handler: fn,
+	})
+	return m
+}
+
+// RoundTrip uses the last registered matched route, unmatched request returns an error
+func (m *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := &MockCall{
+		Method: req.Method,
+		Url:    req.URL.String(),
+		Path:   req.URL.Path,
+		Header: req.Header.Clone(),
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		call.Body = body
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	var route *mockRoute
+	for i := len(m.routes) - 1; i >= 0; i-- {
+		r := m.routes[i]
+		if (r.method == "" || r.method == req.Method) && r.path == req.URL.Path {
+			route = r
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if route == nil {
+		return nil, fmt.Errorf("mock: no route for %s %s", req.Method, redactURL(req.URL.String()))
+	}
+	return route.handler(req)
+}
+
+// Calls returns all requests received, in order
+func (m *MockTransport) Calls() []*MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*MockCall(nil), m.calls...)
+}
+
+// CallCount returns number of requests received of method and url path
+func (m *MockTransport) CallCount(method, path string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, c := range m.calls {
+		if c.Method == method && c.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+func NewMockResponse(req *http.Request, code int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,243 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default time before expiry to refresh token
+const defaultExpiryDelta = 30 * time.Second
+
+type OAuth2Option struct {
+	TokenUrl     string
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+
+	// if set, refresh_token grant is used instead of client_credentials,
+	// it is replaced when token endpoint returns a new one
+	RefreshToken string
+
+	// extra form parameters, e.g. audience
+	Params map[string]string
+
+	// send client id and secret by Basic auth header instead of form fields
+	AuthInHeader bool
+
+	// token is refreshed ExpiryDelta before it expires, default is 30s
+	ExpiryDelta time.Duration
+
+	// client used to request token, default is DefaultClient.
+	// it must not use the Middleware of this TokenSource
+	Client *Client
+}
+
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresIn    int64     `json:"expires_in,omitempty"`
+	Expiry       time.Time `json:"-"`
+}
+
+// token without expires_in never expires
+func (t *Token) valid(delta time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry)
+}
+
+func (t *Token) header() string {
+	typ := t.TokenType
+	if typ == "" || strings.EqualFold(typ, "bearer") {
+		typ = "Bearer"
+	}
+	return typ + " " + t.AccessToken
+}
+
+// TokenSource fetches and caches OAuth2 tokens, it is safe for concurrent use,
+// concurrent callers share one token request
+//
+//	ts := NewTokenSource(&OAuth2Option{TokenUrl: url, ClientId: id, ClientSecret: secret})
+//	client := NewClient(&ClientOption{Middlewares: []Middleware{LogMiddleware, ts.Middleware}})
+type TokenSource struct {
+	opt *OAuth2Option
+
+	mu           sync.Mutex
+	token        *Token
+	refreshToken string
+	inflight     *tokenCall
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+func NewTokenSource(opt *OAuth2Option) *TokenSource {
+	if opt.ExpiryDelta <= 0 {
+		opt.ExpiryDelta = defaultExpiryDelta
+	}
+	return &TokenSource{
+		opt:          opt,
+		refreshToken: opt.RefreshToken,
+	}
+}
+
+// Token returns cached token, or requests a new one if it is about to expire
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	if s.token.valid(s.opt.ExpiryDelta) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+
+	call := s.inflight
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		s.inflight = call
+		// detached from caller's cancellation, other callers are waiting for it too
+		fctx := zerolog.Ctx(ctx).WithContext(context.Background())
+		go s.fetch(fctx, call)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Invalidate drops the cached token if it is still stale, e.g. server answered 401
+func (s *TokenSource) Invalidate(stale *Token) {
+	s.mu.Lock()
+	if s.token == stale {
+		s.token = nil
+	}
+	s.mu.Unlock()
+}
+
+func (s *TokenSource) fetch(ctx context.Context, call *tokenCall) {
+	call.token, call.err = s.requestToken(ctx)
+
+	s.mu.Lock()
+	if call.err == nil {
+		s.token = call.token
+		if call.token.RefreshToken != "" {
+			s.refreshToken = call.token.RefreshToken
+		}
+	}
+	s.inflight = nil
+	s.mu.Unlock()
+
+	close(call.done)
+}
+
+func (s *TokenSource) requestToken(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	refreshToken := s.refreshToken
+	s.mu.Unlock()
+
+	form := NewForm()
+	if refreshToken != "" {
+		form.Set("grant_type", "refresh_token").Set("refresh_token", refreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(s.opt.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.opt.Scopes, " "))
+	}
+	for k, v := range s.opt.Params {
+		form.Set(k, v)
+	}
+
+	req := &ClientRequest{
+		Ctx:          ctx,
+		Url:          s.opt.TokenUrl,
+		FailOnNon2xx: true,
+	}
+	if s.opt.AuthInHeader {
+		// rfc6749 2.3.1, id and secret are form encoded before basic auth
+		auth := url.QueryEscape(s.opt.ClientId) + ":" + url.QueryEscape(s.opt.ClientSecret)
+		req.Headers = map[string]string{
+			"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(auth)),
+		}
+	} else {
+		form.Set("client_id", s.opt.ClientId).Set("client_secret", s.opt.ClientSecret)
+	}
+	form.Apply(req)
+
+	var token *Token
+	req.V = &token
+
+	client := s.opt.Client
+	if client == nil {
+		client = DefaultClient
+	}
+	resp := client.Post(req)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	if token == nil || token.AccessToken == "" {
+		return nil, errors.New("oauth2: token response has no access_token")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	resp.Logger.Debug().Str("tokenType", token.TokenType).Int64("expiresIn", token.ExpiresIn).Msg("oauth2 token refreshed")
+	return token, nil
+}
+
+// Middleware sets Authorization header of request,
+// if server answers 401, the token is refreshed and request is retried once.
+// request with a stream body is not retried
+func (s *TokenSource) Middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		token, err := s.Token(req.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		r := req.Clone(req.Context())
+		r.Header.Set("Authorization", token.header())
+		resp, err := next.RoundTrip(r)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, nil
+		}
+
+		zerolog.Ctx(req.Context()).Debug().Msg("oauth2 token rejected, refresh and retry")
+		s.Invalidate(token)
+		token, err = s.Token(req.Context())
+		if err != nil {
+			return resp, nil
+		}
+
+		r = req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			r.Body = body
+		}
+		resp.Body.Close()
+		r.Header.Set("Authorization", token.header())
+		return next.RoundTrip(r)
+	})
+}
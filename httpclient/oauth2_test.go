@@ -0,0 +1,86 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenSource(t *testing.T) {
+	var issued int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "app" || secret != "s3cret" || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// slow token endpoint, concurrent callers should share one request
+		time.Sleep(20 * time.Millisecond)
+		n := atomic.AddInt32(&issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"tok-%d","token_type":"bearer","expires_in":3600}`, n)
+	}))
+	defer tokenServer.Close()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		// first token is revoked
+		if r.Header.Get("Authorization") != "Bearer tok-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(body)
+	}))
+	defer apiServer.Close()
+
+	ts := NewTokenSource(&OAuth2Option{
+		TokenUrl:     tokenServer.URL,
+		ClientId:     "app",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"read", "write"},
+		AuthInHeader: true,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := ts.Token(context.Background())
+			if err != nil || token.AccessToken != "tok-1" {
+				t.Errorf("unexpected token: %v %v", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if issued != 1 {
+		t.Fatalf("expect one token request, got %d", issued)
+	}
+
+	client := NewClient(&ClientOption{Middlewares: []Middleware{ts.Middleware}})
+	resp := client.Post(&ClientRequest{
+		Ctx:          context.Background(),
+		Url:          apiServer.URL,
+		Body:         []byte("payload"),
+		FailOnNon2xx: true,
+	})
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if string(resp.Body) != "payload" || issued != 2 {
+		t.Errorf("expect retry with refreshed token: %s, issued %d", resp.Body, issued)
+	}
+
+	// token is cached
+	resp = client.Get(&ClientRequest{Ctx: context.Background(), Url: apiServer.URL})
+	if resp.Err != nil || resp.Code != http.StatusOK || issued != 2 {
+		t.Errorf("expect cached token: %v %d, issued %d", resp.Err, resp.Code, issued)
+	}
+}
@@ -0,0 +1,155 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	dialTimeout   = 30 * time.Second
+	dialKeepAlive = 30 * time.Second
+)
+
+// proxyFunc routes requests through proxyUrl except hosts matched by noProxy,
+// an invalid proxyUrl fails every request with the parse error
+func proxyFunc(proxyUrl, noProxy string) func(req *http.Request) (*url.URL, error) {
+	u, err := url.Parse(proxyUrl)
+	if err == nil && (u.Host == "" || !isProxyScheme(u.Scheme)) {
+		err = fmt.Errorf("invalid proxy[%s], should be like http://host:port or socks5://host:port", redactURL(proxyUrl))
+	}
+	rules := parseNoProxy(noProxy)
+
+	return func(req *http.Request) (*url.URL, error) {
+		if err != nil {
+			return nil, err
+		}
+		if rules.match(req.URL) {
+			return nil, nil
+		}
+		return u, nil
+	}
+}
+
+func isProxyScheme(scheme string) bool {
+	switch scheme {
+	case "http", "https", "socks5":
+		return true
+	}
+	return false
+}
+
+type noProxyRules struct {
+	all     bool
+	domains []noProxyDomain
+	nets    []*net.IPNet
+}
+
+type noProxyDomain struct {
+	host string
+	port string
+	// ".example.com" only matches subdomains
+	subOnly bool
+}
+
+// parseNoProxy parses comma separated NO_PROXY entries:
+// "*", host names, ".domain" (subdomains), "domain" (itself and subdomains), IPs and CIDRs, optionally with ":port"
+func parseNoProxy(s string) *noProxyRules {
+	rules := &noProxyRules{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			rules.all = true
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			rules.nets = append(rules.nets, ipNet)
+			continue
+		}
+
+		host, port := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, port = h, p
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			if port == "" {
+				rules.nets = append(rules.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+
+		d := noProxyDomain{host: host, port: port}
+		if strings.HasPrefix(host, "*.") {
+			d.host, d.subOnly = host[1:], true
+		} else if strings.HasPrefix(host, ".") {
+			d.subOnly = true
+		}
+		rules.domains = append(rules.domains, d)
+	}
+	return rules
+}
+
+func (r *noProxyRules) match(u *url.URL) bool {
+	if r.all {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, n := range r.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	for _, d := range r.domains {
+		if d.port != "" && d.port != port {
+			continue
+		}
+		if d.subOnly {
+			if strings.HasSuffix(host, d.host) {
+				return true
+			}
+		} else if host == d.host || strings.HasSuffix(host, "."+d.host) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialContext returns the dialer configured by opt, nil if default dialer is fine
+func dialContext(opt *ClientOption) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if opt.DialContext != nil {
+		return opt.DialContext
+	}
+	if opt.UnixSocket == "" && opt.Resolver == nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: dialKeepAlive,
+		Resolver:  opt.Resolver,
+	}
+	if opt.UnixSocket == "" {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", opt.UnixSocket)
+	}
+}
@@ -0,0 +1,117 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestNoProxy(t *testing.T) {
+	rules := parseNoProxy("localhost, .svc.cluster.local,example.com,10.0.0.0/8,192.168.1.1,api.io:8443")
+	cases := map[string]bool{
+		"http://localhost:8080/":              true,
+		"http://couchdb.svc.cluster.local/":   true,
+		"http://svc.cluster.local/":           false,
+		"http://example.com/":                 true,
+		"http://www.example.com/":             true,
+		"http://notexample.com/":              false,
+		"http://10.1.2.3/":                    true,
+		"http://192.168.1.1:5984/":            true,
+		"http://192.168.1.2/":                 false,
+		"https://api.io:8443/":                true,
+		"https://api.io/":                     false,
+		"http://upstream.partner.com/webhook": false,
+	}
+	for raw, expect := range cases {
+		u, _ := url.Parse(raw)
+		if rules.match(u) != expect {
+			t.Errorf("%s: expect %v", raw, expect)
+		}
+	}
+
+	u, _ := url.Parse("http://any.host/")
+	if !parseNoProxy("*").match(u) {
+		t.Error("* should match any host")
+	}
+}
+
+func TestProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// proxy receives absolute url
+		auth := r.Header.Get("Proxy-Authorization")
+		fmt.Fprintf(w, "proxy %s %s", r.URL.String(), auth)
+	}))
+	defer proxy.Close()
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+
+	pu, _ := url.Parse(proxy.URL)
+	client := NewClient(&ClientOption{
+		Proxy:   "http://user:pass@" + pu.Host,
+		NoProxy: "127.0.0.1",
+	})
+
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://upstream.example.com/path?a=1"})
+	expect := "proxy http://upstream.example.com/path?a=1 Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	if resp.Err != nil || string(resp.Body) != expect {
+		t.Errorf("request should go through proxy: %v %s", resp.Err, resp.Body)
+	}
+
+	resp = client.Get(&ClientRequest{Ctx: context.Background(), Url: direct.URL})
+	if resp.Err != nil || string(resp.Body) != "direct" {
+		t.Errorf("NO_PROXY host should be connected directly: %v %s", resp.Err, resp.Body)
+	}
+
+	client = NewClient(&ClientOption{Proxy: "ftp://" + pu.Host})
+	resp = client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://upstream.example.com/"})
+	if resp.Err == nil {
+		t.Error("invalid proxy should fail requests")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "sidecar.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip("unix socket is not supported:", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Host, r.URL.Path)
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	client := NewClient(&ClientOption{UnixSocket: sock, Proxy: "http://127.0.0.1:1"})
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://sidecar/v1/ping"})
+	if resp.Err != nil || string(resp.Body) != "sidecar /v1/ping" {
+		t.Errorf("unexpected response: %v %s", resp.Err, resp.Body)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	// resolve a service name to the test server
+	var dialed string
+	client := NewClient(&ClientOption{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = addr
+			return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+		},
+	})
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://payment.internal:8080/"})
+	if resp.Err != nil || string(resp.Body) != "ok" || dialed != "payment.internal:8080" {
+		t.Errorf("unexpected response: %v %s, dialed %s", resp.Err, resp.Body, dialed)
+	}
+}
@@ -0,0 +1,195 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("rate limited")
+
+type RateLimitOption struct {
+	// tokens per second and bucket size, Burst default is 1.
+	// Rate <= 0 means no limit, only Adaptive pausing is applied
+	Rate  float64
+	Burst int
+
+	// bucket key of request, default is KeyByHost
+	Key func(req *http.Request) string
+
+	// if true, return ErrRateLimited immediately instead of waiting for a token
+	FailFast bool
+
+	// if true, pause the bucket by Retry-After of 429/503 response,
+	// or by X-RateLimit-Reset when X-RateLimit-Remaining is 0
+	Adaptive bool
+}
+
+// KeyByHost uses a bucket per destination host
+func KeyByHost(req *http.Request) string {
+	return req.URL.Host
+}
+
+// KeyByName uses one bucket for all requests, e.g. the name of a client
+func KeyByName(name string) func(req *http.Request) string {
+	return func(req *http.Request) string {
+		return name
+	}
+}
+
+// RateLimiter is a token bucket rate limiter of outbound requests,
+// it can be shared by several clients
+//
+//	limiter := NewRateLimiter(&RateLimitOption{Rate: 10, Burst: 10, Adaptive: true})
+//	client := NewClient(&ClientOption{Middlewares: []Middleware{LogMiddleware, limiter.Middleware}})
+type RateLimiter struct {
+	opt *RateLimitOption
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewRateLimiter(opt *RateLimitOption) *RateLimiter {
+	if opt.Burst < 1 {
+		opt.Burst = 1
+	}
+	if opt.Key == nil {
+		opt.Key = KeyByHost
+	}
+	return &RateLimiter{
+		opt:     opt,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// set by Adaptive, no token is available before it
+	pausedUntil time.Time
+}
+
+func (l *RateLimiter) getBucket(key string) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens: float64(l.opt.Burst),
+			last:   time.Now(),
+		}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// take reserves a token and returns how long to wait for it,
+// if failFast and token is not available now, nothing is reserved and ok is false
+func (b *bucket) take(now time.Time, rate float64, burst int, failFast bool) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+		b.last = now
+	}
+
+	if b.pausedUntil.After(now) {
+		wait = b.pausedUntil.Sub(now)
+	}
+	if rate > 0 && b.tokens < 1 {
+		if d := time.Duration((1 - b.tokens) / rate * float64(time.Second)); d > wait {
+			wait = d
+		}
+	}
+
+	if failFast && wait > 0 {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// give back a reserved token when waiting is canceled
+func (b *bucket) putBack() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+func (b *bucket) pause(until time.Time) {
+	b.mu.Lock()
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	b.mu.Unlock()
+}
+
+func (l *RateLimiter) Middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		key := l.opt.Key(req)
+		b := l.getBucket(key)
+
+		wait, ok := b.take(time.Now(), l.opt.Rate, l.opt.Burst, l.opt.FailFast)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s, retry after %s", ErrRateLimited, key, wait)
+		}
+		if wait > 0 {
+			zerolog.Ctx(req.Context()).Debug().Str("rateLimitKey", key).Str("wait", wait.String()).Msg("rate limited, waiting")
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				b.putBack()
+				return nil, req.Context().Err()
+			}
+		}
+
+		resp, err := next.RoundTrip(req)
+		if err == nil && l.opt.Adaptive {
+			if until, ok := pauseUntil(resp, time.Now()); ok {
+				zerolog.Ctx(req.Context()).Warn().Str("rateLimitKey", key).Time("pausedUntil", until).Msg("rate limit reached by server")
+				b.pause(until)
+			}
+		}
+		return resp, err
+	})
+}
+
+// pauseUntil parses Retry-After or X-RateLimit-* headers
+func pauseUntil(resp *http.Response, now time.Time) (time.Time, bool) {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if ra := resp.Header.Get("Retry-After"); ra != "" {
+			if sec, err := strconv.Atoi(ra); err == nil {
+				return now.Add(time.Duration(sec) * time.Second), true
+			}
+			if t, err := http.ParseTime(ra); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		// some APIs send unix time, others send seconds to wait
+		if reset > 1e9 {
+			return time.Unix(reset, 0), true
+		}
+		return now.Add(time.Duration(reset) * time.Second), true
+	}
+
+	return time.Time{}, false
+}
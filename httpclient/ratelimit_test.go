@@ -0,0 +1,74 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	mock := NewMockTransport().On("GET", "/", 200, "OK")
+	limiter := NewRateLimiter(&RateLimitOption{Rate: 20, Burst: 1})
+	client := NewClient(&ClientOption{Transport: mock, Middlewares: []Middleware{limiter.Middleware}})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://a.local/"})
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expect requests to wait for tokens, elapsed %s", elapsed)
+	}
+
+	// buckets are per host
+	start = time.Now()
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://b.local/"})
+	if resp.Err != nil || time.Since(start) > 40*time.Millisecond {
+		t.Errorf("another host should not wait: %v %s", resp.Err, time.Since(start))
+	}
+
+	// waiting respects context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	limiter = NewRateLimiter(&RateLimitOption{Rate: 1, Burst: 1})
+	client = NewClient(&ClientOption{Transport: mock, Middlewares: []Middleware{limiter.Middleware}})
+	client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://a.local/"})
+	resp = client.Get(&ClientRequest{Ctx: ctx, Url: "http://a.local/"})
+	if !errors.Is(resp.Err, context.DeadlineExceeded) {
+		t.Errorf("expect context deadline, got %v", resp.Err)
+	}
+}
+
+func TestRateLimiterAdaptive(t *testing.T) {
+	mock := NewMockTransport().
+		OnFunc("GET", "/", func(req *http.Request) (*http.Response, error) {
+			resp := NewMockResponse(req, http.StatusTooManyRequests, "")
+			resp.Header.Set("Retry-After", "30")
+			return resp, nil
+		})
+	limiter := NewRateLimiter(&RateLimitOption{
+		Rate:     100,
+		Burst:    10,
+		Key:      KeyByName("partner"),
+		FailFast: true,
+		Adaptive: true,
+	})
+	client := NewClient(&ClientOption{Transport: mock, Middlewares: []Middleware{limiter.Middleware}})
+
+	resp := client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://a.local/"})
+	if resp.Err != nil || resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected response: %v %d", resp.Err, resp.Code)
+	}
+
+	resp = client.Get(&ClientRequest{Ctx: context.Background(), Url: "http://b.local/"})
+	if !errors.Is(resp.Err, ErrRateLimited) {
+		t.Errorf("expect ErrRateLimited, got %v", resp.Err)
+	}
+	if len(mock.Calls()) != 1 {
+		t.Errorf("paused request should not be sent, calls %d", len(mock.Calls()))
+	}
+}
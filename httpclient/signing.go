@@ -0,0 +1,123 @@
+package httpclient
+
+import (
+	"errors"
+	"github.com/leyle/go-api-starter/util"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HMAC-SHA256 request signing, signature is hex encoded HMAC of SignString.
+// ginhelper.SignatureMiddleware verifies it on the server side
+
+var ErrSignStreamBody = errors.New("sign: stream request body can not be signed")
+
+type SignHeaders struct {
+	Signature string
+	Timestamp string
+	Nonce     string
+	KeyId     string
+}
+
+var DefaultSignHeaders = &SignHeaders{
+	Signature: "X-Signature",
+	Timestamp: "X-Timestamp",
+	Nonce:     "X-Nonce",
+	KeyId:     "X-Key-Id",
+}
+
+type SignOption struct {
+	KeyId  string
+	Secret string
+
+	// default is DefaultSignHeaders
+	Headers *SignHeaders
+
+	// request headers also signed, e.g. "Content-Type", "Host",
+	// the server must be configured with the same list in the same order.
+	// only headers set before signing count, not the ones added by http.Transport, e.g. User-Agent
+	SignedHeaders []string
+}
+
+// SignString is the signed content:
+// METHOD \n request uri (path and raw query) \n unix timestamp \n nonce \n hex sha256 of body,
+// followed by \n headerLines, see SignedHeaderLines
+func SignString(method, uri, timestamp, nonce string, body []byte, headerLines ...string) string {
+	parts := []string{
+		strings.ToUpper(method),
+		uri,
+		timestamp,
+		nonce,
+		util.Sha256(string(body)),
+	}
+	return strings.Join(append(parts, headerLines...), "\n")
+}
+
+func Sign(secret, method, uri, timestamp, nonce string, body []byte, headerLines ...string) string {
+	return util.HmacSha256(secret, SignString(method, uri, timestamp, nonce, body, headerLines...))
+}
+
+// SignedHeaderLines returns "name:value" of names in order, name in lower case,
+// multiple values are joined by ",", a missing header has empty value.
+// "Host" is read from req.Host, or req.URL.Host on the client side
+func SignedHeaderLines(req *http.Request, names []string) []string {
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		var value string
+		if strings.EqualFold(name, "Host") {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		} else {
+			value = strings.Join(req.Header.Values(name), ",")
+		}
+		lines = append(lines, strings.ToLower(name)+":"+strings.TrimSpace(value))
+	}
+	return lines
+}
+
+// NewSignMiddleware signs every request by opt, stream bodies can not be signed
+func NewSignMiddleware(opt *SignOption) Middleware {
+	headers := opt.Headers
+	if headers == nil {
+		headers = DefaultSignHeaders
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			var body []byte
+			if req.Body != nil && req.Body != http.NoBody {
+				if req.GetBody == nil {
+					return nil, ErrSignStreamBody
+				}
+				rc, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				body, err = ioutil.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			nonce := util.GenerateDataId()
+
+			r := req.Clone(req.Context())
+			r.Header.Set(headers.Timestamp, timestamp)
+			r.Header.Set(headers.Nonce, nonce)
+			if opt.KeyId != "" {
+				r.Header.Set(headers.KeyId, opt.KeyId)
+			}
+			r.Header.Set(headers.Signature, Sign(opt.Secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body,
+				SignedHeaderLines(r, opt.SignedHeaders)...))
+
+			return next.RoundTrip(r)
+		})
+	}
+}
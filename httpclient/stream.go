@@ -0,0 +1,77 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// Download saves response body into file path.
+// if the file already exists, it sends a Range header to resume from current file size,
+// server answers 206 -> append, 200 -> rewrite whole file, 416 -> file is already complete,
+// other status codes fail, so ExpectStatus and FailOnNon2xx of req are ignored
+func (c *Client) Download(req *ClientRequest, path string) *ClientResponse {
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	headers := make(map[string]string, len(req.Headers)+1)
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+
+	dReq := *req
+	dReq.Headers = headers
+	dReq.method = http.MethodGet
+	dReq.ExpectStatus = nil
+	dReq.FailOnNon2xx = false
+	dReq.Stream = func(resp *ClientResponse, body io.Reader) error {
+		return saveDownload(resp, body, path, offset)
+	}
+
+	return c.httpRequest(&dReq)
+}
+
+func saveDownload(resp *ClientResponse, body io.Reader, path string, offset int64) error {
+	flag := os.O_CREATE | os.O_WRONLY
+	switch resp.Code {
+	case http.StatusPartialContent:
+		var start int64
+		_, err := fmt.Sscanf(resp.Raw.Header.Get("Content-Range"), "bytes %d-", &start)
+		if err != nil || start != offset {
+			return fmt.Errorf("invalid Content-Range[%s], expect start at %d", resp.Raw.Header.Get("Content-Range"), offset)
+		}
+		flag |= os.O_APPEND
+	case http.StatusOK:
+		flag |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset > 0 {
+			resp.Logger.Debug().Str("file", path).Msg("file already downloaded")
+			return nil
+		}
+		return fmt.Errorf("download failed, statusCode[%d]", resp.Code)
+	default:
+		return fmt.Errorf("download failed, statusCode[%d]", resp.Code)
+	}
+
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	resp.Logger.Debug().Str("file", path).Int64("offset", offset).Int64("written", n).Msg("download done")
+	return nil
+}
@@ -0,0 +1,93 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.ContentLength != -1 {
+			t.Errorf("expect chunked body, got content length %d", r.ContentLength)
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	var got bytes.Buffer
+	req := &ClientRequest{
+		Ctx:        context.Background(),
+		Url:        ts.URL,
+		BodyReader: io.MultiReader(strings.NewReader(content)),
+		Stream: func(resp *ClientResponse, body io.Reader) error {
+			_, err := io.Copy(&got, body)
+			return err
+		},
+	}
+
+	resp := Post(req)
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if resp.Body != nil {
+		t.Error("expect response body not buffered")
+	}
+	if got.String() != content {
+		t.Errorf("stream body mismatch, got %d bytes", got.Len())
+	}
+}
+
+func TestDownload(t *testing.T) {
+	content := strings.Repeat("abcdefghij", 1000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "data.txt")
+
+	// partial file already exists, should resume
+	if err := ioutil.WriteFile(path, []byte(content[:4000]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &ClientRequest{
+		Ctx:          context.Background(),
+		Url:          ts.URL,
+		FailOnNon2xx: true,
+	}
+	resp := Download(req, path)
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if resp.Code != http.StatusPartialContent {
+		t.Errorf("expect 206, got %d", resp.Code)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != content {
+		t.Fatalf("downloaded file mismatch, got %d bytes", len(data))
+	}
+
+	// file is complete, download again is a no-op
+	resp = Download(req, path)
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if resp.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expect 416, got %d", resp.Code)
+	}
+	if req.Headers != nil {
+		t.Error("caller headers should not be modified")
+	}
+}
@@ -0,0 +1,107 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing is the phase breakdown of a request, phases not happened are 0,
+// e.g. DNS, Connect and TLS of a reused connection
+type Timing struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+
+	// from request start to the first response byte
+	TTFB time.Duration
+
+	// reading response body, or Stream consuming it
+	BodyRead time.Duration
+
+	Total time.Duration
+
+	// connection is reused from idle pool
+	Reused bool
+}
+
+// tracer collects httptrace events, callbacks may be called concurrently
+type tracer struct {
+	mu    sync.Mutex
+	start time.Time
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	firstByte, gotResponse    time.Time
+	reused                    bool
+}
+
+func newTracer() *tracer {
+	return &tracer{start: time.Now()}
+}
+
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	set := func(field *time.Time, keepFirst bool) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if keepFirst && !field.IsZero() {
+			return
+		}
+		*field = time.Now()
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { set(&t.dnsStart, true) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { set(&t.dnsDone, false) },
+		// dual stack dialing may start several connects
+		ConnectStart:      func(string, string) { set(&t.connectStart, true) },
+		ConnectDone:       func(string, string, error) { set(&t.connectDone, false) },
+		TLSHandshakeStart: func() { set(&t.tlsStart, true) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { set(&t.tlsDone, false) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.reused = info.Reused
+		},
+		GotFirstResponseByte: func() { set(&t.firstByte, false) },
+	}
+}
+
+// responseGot marks the start of body reading
+func (t *tracer) responseGot() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.gotResponse = time.Now()
+}
+
+func (t *tracer) timing() *Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	end := time.Now()
+	span := func(start, done time.Time) time.Duration {
+		if start.IsZero() || done.IsZero() || done.Before(start) {
+			return 0
+		}
+		return done.Sub(start)
+	}
+
+	timing := &Timing{
+		DNS:     span(t.dnsStart, t.dnsDone),
+		Connect: span(t.connectStart, t.connectDone),
+		TLS:     span(t.tlsStart, t.tlsDone),
+		TTFB:    span(t.start, t.firstByte),
+		Total:   end.Sub(t.start),
+		Reused:  t.reused,
+	}
+	if !t.gotResponse.IsZero() {
+		timing.BodyRead = end.Sub(t.gotResponse)
+		if timing.TTFB == 0 {
+			// transport without trace events, e.g. MockTransport
+			timing.TTFB = t.gotResponse.Sub(t.start)
+		}
+	}
+	return timing
+}
@@ -0,0 +1,97 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/leyle/go-api-starter/confighelper"
+	"io/ioutil"
+)
+
+var ErrSPKIPinMismatch = errors.New("tls: server certificate does not match any pinned spki hash")
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// LoadTLSConfig generates tls.Config for ClientOption.TLS from config
+func LoadTLSConfig(opt *confighelper.TLSOption) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         opt.ServerName,
+		InsecureSkipVerify: opt.InsecureSkipVerify,
+	}
+
+	if opt.MinVersion != "" {
+		v, ok := tlsVersions[opt.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls minVersion[%s], should be one of 1.0/1.1/1.2/1.3", opt.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+
+	if len(opt.CAFiles) > 0 {
+		pool := x509.NewCertPool()
+		for _, path := range opt.CAFiles {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("read ca file[%s] failed, %w", path, err)
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no PEM certificate found in ca file[%s]", path)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	if opt.CertFile != "" || opt.KeyFile != "" {
+		if opt.CertFile == "" || opt.KeyFile == "" {
+			return nil, errors.New("both certFile and keyFile are required for client certificate")
+		}
+		cert, err := tls.LoadX509KeyPair(opt.CertFile, opt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert[%s] key[%s] failed, %w", opt.CertFile, opt.KeyFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(opt.PinnedSPKI) > 0 {
+		pins := make(map[string]bool, len(opt.PinnedSPKI))
+		for _, pin := range opt.PinnedSPKI {
+			raw, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("invalid spki pin[%s], should be base64 encoded sha256", pin)
+			}
+			pins[pin] = true
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			// only verified chains count, extra certs sent by server are not trusted
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if pins[SPKIHash(cert)] {
+						return nil
+					}
+				}
+			}
+			// nothing is verified with InsecureSkipVerify, only the leaf can be pinned
+			if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 && pins[SPKIHash(cs.PeerCertificates[0])] {
+				return nil
+			}
+			return ErrSPKIPinMismatch
+		}
+	}
+
+	return cfg, nil
+}
+
+// SPKIHash returns base64 encoded sha256 of cert SubjectPublicKeyInfo, the value used by PinnedSPKI
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
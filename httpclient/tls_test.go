@@ -0,0 +1,165 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/leyle/go-api-starter/confighelper"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writes a self-signed client cert/key pair into dir
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600)
+	certFile, keyFile := writeClientCert(t, dir)
+
+	opt := &confighelper.TLSOption{
+		CAFiles:    []string{caFile},
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		MinVersion: "1.2",
+		PinnedSPKI: []string{SPKIHash(ts.Certificate())},
+	}
+	cfg, err := LoadTLSConfig(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := NewClient(&ClientOption{TLS: cfg}).Get(&ClientRequest{
+		Ctx:          context.Background(),
+		Url:          ts.URL,
+		FailOnNon2xx: true,
+	})
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if string(resp.Body) != "test-client" {
+		t.Errorf("unexpected response: %s", resp.Body)
+	}
+
+	// pin of another key
+	opt.PinnedSPKI = []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}
+	cfg, err = LoadTLSConfig(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = NewClient(&ClientOption{TLS: cfg}).Get(&ClientRequest{
+		Ctx: context.Background(),
+		Url: ts.URL,
+	})
+	if !errors.Is(resp.Err, ErrSPKIPinMismatch) {
+		t.Errorf("expect pin mismatch, got %v", resp.Err)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	bad := []*confighelper.TLSOption{
+		{CAFiles: []string{"/not/exist.pem"}},
+		{CertFile: "/not/exist.pem"},
+		{MinVersion: "1.4"},
+		{PinnedSPKI: []string{"not-base64"}},
+	}
+	for _, opt := range bad {
+		if _, err := LoadTLSConfig(opt); err == nil {
+			t.Errorf("expect error of %+v", opt)
+		} else {
+			t.Log(err)
+		}
+	}
+}
+
+func TestTLSPinExtraCert(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts.StartTLS()
+	defer ts.Close()
+
+	// server appends a cert of the pinned key to its unpinned chain
+	dir := t.TempDir()
+	pinnedFile, _ := writeClientCert(t, dir)
+	data, _ := ioutil.ReadFile(pinnedFile)
+	block, _ := pem.Decode(data)
+	pinned, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.TLS.Certificates[0].Certificate = append(ts.TLS.Certificates[0].Certificate, pinned.Raw)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600)
+
+	get := func(opt *confighelper.TLSOption) error {
+		cfg, err := LoadTLSConfig(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewClient(&ClientOption{TLS: cfg}).Get(&ClientRequest{
+			Ctx: context.Background(),
+			Url: ts.URL,
+		}).Err
+	}
+
+	if err := get(&confighelper.TLSOption{CAFiles: []string{caFile}, PinnedSPKI: []string{SPKIHash(pinned)}}); !errors.Is(err, ErrSPKIPinMismatch) {
+		t.Errorf("extra cert should not pass the pin, got %v", err)
+	}
+	if err := get(&confighelper.TLSOption{InsecureSkipVerify: true, PinnedSPKI: []string{SPKIHash(pinned)}}); !errors.Is(err, ErrSPKIPinMismatch) {
+		t.Errorf("extra cert should not pass the pin without verification, got %v", err)
+	}
+	if err := get(&confighelper.TLSOption{InsecureSkipVerify: true, PinnedSPKI: []string{SPKIHash(ts.Certificate())}}); err != nil {
+		t.Errorf("pinned leaf should pass without verification, got %v", err)
+	}
+}
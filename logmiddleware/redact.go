@@ -0,0 +1,321 @@
+package logmiddleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// mask sensitive data before it is written into log,
+// used by httpclient debug logging and ginhelper.GinLogMiddleware
+
+const DefaultMask = "******"
+
+type Redactor struct {
+	// header names, case insensitive
+	Headers []string
+
+	// JSON field names matched at any depth, e.g. "passwd",
+	// or dotted paths matched from the root, e.g. "user.credential.secret",
+	// arrays are walked through transparently. case insensitive
+	Fields []string
+
+	// url query parameter names, case insensitive
+	Query []string
+
+	// max body bytes written into log, 0 means no limit
+	MaxBodySize int
+
+	// default is DefaultMask
+	Mask string
+}
+
+var DefaultRedactor = &Redactor{
+	Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Token", "Token", "X-Api-Key"},
+	Fields: []string{"passwd", "password", "secret", "token", "access_token", "refresh_token",
+		"accessToken", "refreshToken", "client_secret"},
+	Query:       []string{"token", "access_token", "secret", "passwd", "password", "sig", "signature"},
+	MaxBodySize: 4096,
+}
+
+func (r *Redactor) mask() string {
+	if r.Mask == "" {
+		return DefaultMask
+	}
+	return r.Mask
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns a copy of h with sensitive values masked
+func (r *Redactor) Header(h http.Header) http.Header {
+	ret := make(http.Header, len(h))
+	for k, vs := range h {
+		if containsFold(r.Headers, k) {
+			masked := make([]string, len(vs))
+			for i := range vs {
+				masked[i] = r.mask()
+			}
+			ret[k] = masked
+		} else {
+			ret[k] = vs
+		}
+	}
+	return ret
+}
+
+// URL returns u as string with sensitive query parameters masked,
+// order of query parameters is kept
+func (r *Redactor) URL(u *url.URL) string {
+	if u.RawQuery == "" || len(r.Query) == 0 {
+		return u.String()
+	}
+
+	masked, changed := r.maskPairs(u.RawQuery, r.Query)
+	if !changed {
+		return u.String()
+	}
+
+	nu := *u
+	nu.RawQuery = masked
+	return nu.String()
+}
+
+// Form masks fields of an urlencoded form body, field names are matched by Fields,
+// dotted paths by their last name
+func (r *Redactor) Form(data []byte) []byte {
+	masked, changed := r.maskPairs(string(data), r.leafFields())
+	if !changed {
+		return data
+	}
+	return []byte(masked)
+}
+
+// maskPairs masks values of "key=value" pairs joined by "&" whose key is in names
+func (r *Redactor) maskPairs(raw string, names []string) (string, bool) {
+	parts := strings.Split(raw, "&")
+	changed := false
+	for i, part := range parts {
+		key := strings.SplitN(part, "=", 2)[0]
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if containsFold(names, key) {
+			parts[i] = strings.SplitN(part, "=", 2)[0] + "=" + r.mask()
+			changed = true
+		}
+	}
+	return strings.Join(parts, "&"), changed
+}
+
+func (r *Redactor) leafFields() []string {
+	names := make([]string, 0, len(r.Fields))
+	for _, f := range r.Fields {
+		names = append(names, f[strings.LastIndex(f, ".")+1:])
+	}
+	return names
+}
+
+// Partial masks `"field": value` pairs in data that may not be a complete JSON document,
+// e.g. a truncated body. field names are matched by Fields, dotted paths by their last name.
+// string, scalar, object and array values are masked, a value cut at the end is masked to the end
+func (r *Redactor) Partial(data []byte) []byte {
+	if len(r.Fields) == 0 {
+		return data
+	}
+	re := partialKeyRegexp(r.leafFields())
+	keys := re.FindAllIndex(data, -1)
+	if len(keys) == 0 {
+		return data
+	}
+
+	mask, _ := json.Marshal(r.mask())
+	var out bytes.Buffer
+	last := 0
+	for _, key := range keys {
+		if key[0] < last {
+			// inside a masked value
+			continue
+		}
+		end := key[1] + jsonValueLen(data[key[1]:])
+		if end == key[1] {
+			continue
+		}
+		out.Write(data[last:key[1]])
+		out.Write(mask)
+		last = end
+	}
+	out.Write(data[last:])
+	return out.Bytes()
+}
+
+// compiled key patterns by field names, Fields may be changed after a Redactor is used
+var partialRegexps sync.Map
+
+func partialKeyRegexp(names []string) *regexp.Regexp {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	pattern := `(?i)"(?:` + strings.Join(quoted, "|") + `)"\s*:\s*`
+	if re, ok := partialRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	partialRegexps.Store(pattern, re)
+	return re
+}
+
+// jsonValueLen returns length of the JSON value at the start of data,
+// or len(data) if the value is cut
+func jsonValueLen(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	switch data[0] {
+	case '"':
+		for i := 1; i < len(data); i++ {
+			switch data[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+		return len(data)
+	case '{', '[':
+		depth := 0
+		inString := false
+		for i := 0; i < len(data); i++ {
+			c := data[i]
+			switch {
+			case inString && c == '\\':
+				i++
+			case c == '"':
+				inString = !inString
+			case inString:
+			case c == '{' || c == '[':
+				depth++
+			case c == '}' || c == ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return len(data)
+	}
+	i := 0
+	for i < len(data) && (data[i] == '-' || data[i] == '+' || data[i] == '.' || data[i] == '_' ||
+		(data[i] >= '0' && data[i] <= '9') || (data[i] >= 'a' && data[i] <= 'z') || (data[i] >= 'A' && data[i] <= 'Z')) {
+		i++
+	}
+	return i
+}
+
+// JSON masks sensitive fields of a JSON document,
+// ok is false if data is not valid JSON and data is returned as is
+func (r *Redactor) JSON(data []byte) ([]byte, bool) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return data, false
+	}
+	if len(r.Fields) == 0 {
+		return data, true
+	}
+
+	if !r.maskValue(v, "") {
+		return data, true
+	}
+	masked, err := json.Marshal(v)
+	if err != nil {
+		return data, false
+	}
+	return masked, true
+}
+
+// walks v and masks matched fields in place, returns true if anything is masked
+func (r *Redactor) maskValue(v interface{}, path string) bool {
+	changed := false
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			if containsFold(r.Fields, k) || containsFold(r.Fields, childPath) {
+				val[k] = r.mask()
+				changed = true
+				continue
+			}
+			if r.maskValue(child, childPath) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, child := range val {
+			if r.maskValue(child, path) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// IsBinary reports whether data can not be logged as text
+func IsBinary(data []byte) bool {
+	return !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0
+}
+
+// Body returns a log safe representation of body:
+// binary data is summarized, JSON fields are masked, also in text or incomplete JSON, and result is truncated to MaxBodySize
+func (r *Redactor) Body(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if IsBinary(body) {
+		return fmt.Sprintf("[binary data, %d bytes]", len(body))
+	}
+
+	masked, ok := r.JSON(body)
+	if !ok {
+		// text or cut JSON
+		masked = r.Partial(body)
+	}
+	return r.Truncate(masked, len(body))
+}
+
+// Truncate cuts data to MaxBodySize at a utf8 boundary, total is the original body size
+func (r *Redactor) Truncate(data []byte, total int) string {
+	return TruncateBody(data, r.MaxBodySize, total)
+}
+
+// TruncateBody cuts data to max bytes at a utf8 boundary and marks it with the original size total,
+// max <= 0 means no limit
+func TruncateBody(data []byte, max, total int) string {
+	if max <= 0 || len(data) <= max {
+		return string(data)
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(truncated, total %d bytes)", data[:cut], total)
+}
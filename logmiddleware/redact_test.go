@@ -0,0 +1,71 @@
+package logmiddleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r := &Redactor{
+		Headers:     []string{"authorization"},
+		Fields:      []string{"passwd", "user.secret"},
+		Query:       []string{"token"},
+		MaxBodySize: 64,
+	}
+
+	h := http.Header{}
+	h.Set("Authorization", "Basic YWRtaW46cGFzc3dk")
+	h.Set("Content-Type", "application/json")
+	rh := r.Header(h)
+	if rh.Get("Authorization") != DefaultMask || rh.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers: %v", rh)
+	}
+	if h.Get("Authorization") == DefaultMask {
+		t.Error("original headers should not be modified")
+	}
+
+	u, _ := url.Parse("http://localhost/login?name=jack&token=abc&Token=def")
+	if got := r.URL(u); got != "http://localhost/login?name=jack&token=******&Token=******" {
+		t.Errorf("unexpected url: %s", got)
+	}
+
+	body := []byte(`{"name":"jack","passwd":"p-one","list":[{"passwd":"p-two"}],"user":{"secret":"x"},"secret":"keep","n":12345678901234567890}`)
+	masked, ok := r.JSON(body)
+	if !ok {
+		t.Fatal("expect valid json")
+	}
+	for _, leaked := range []string{"p-one", "p-two", `"x"`} {
+		if strings.Contains(string(masked), leaked) {
+			t.Errorf("%s leaked: %s", leaked, masked)
+		}
+	}
+	if !strings.Contains(string(masked), `"secret":"keep"`) || !strings.Contains(string(masked), "12345678901234567890") {
+		t.Errorf("unexpected masked json: %s", masked)
+	}
+
+	if got := r.Body([]byte{0xff, 0xfe, 0x00}); got != "[binary data, 3 bytes]" {
+		t.Errorf("unexpected binary body: %s", got)
+	}
+
+	long := strings.Repeat("中", 100)
+	got := r.Body([]byte(long))
+	if !strings.HasSuffix(got, "...(truncated, total 300 bytes)") || !strings.HasPrefix(got, strings.Repeat("中", 21)+"...") {
+		t.Errorf("unexpected truncated body: %s", got)
+	}
+
+	if got := string(r.Form([]byte("name=jack&passwd=p%26w&secret=s"))); got != "name=jack&passwd=******&secret=******" {
+		t.Errorf("unexpected form: %s", got)
+	}
+
+	partial := string(r.Partial([]byte(`{"name":"jack", "Passwd" : "p-\"one", "list":[{"secret":12},{"passwd":"cut-off`)))
+	if partial != `{"name":"jack", "Passwd" : "******", "list":[{"secret":"******"},{"passwd":"******"` {
+		t.Errorf("unexpected partial json: %s", partial)
+	}
+
+	nested := string(r.Partial([]byte(`{"passwd":{"access":"x","list":["}"]},"name":"jack","secret":[{"a":"cut-off`)))
+	if nested != `{"passwd":"******","name":"jack","secret":"******"` {
+		t.Errorf("unexpected partial json with nested values: %s", nested)
+	}
+}
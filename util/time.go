@@ -1,6 +1,7 @@
 package util
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
@@ -65,6 +66,12 @@ func Md5(data string) string {
 	return hex.EncodeToString(m.Sum(nil))
 }
 
+func HmacSha256(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func GenerateDataId() string {
 	id := uuid.New().String()
 	return id